@@ -4,5 +4,8 @@ package api
 const (
 	CountriesAPIIso = "http://129.241.150.113:8080/v3.1/alpha/"
 	CountriesApi    = "http://129.241.150.113:8080/v3.1/name/"
-	CountriesApiAll = "http://129.241.150.113:8080/v3.1/all" // To check status of the API
+	CountriesApiAll = "http://129.241.150.113:8080/v3.1/all"                  // To check status of the API
+	CountriesProbe  = "http://129.241.150.113:8080/v3.1/alpha/no?fields=cca2" // One small country, for readiness probes.
+	CountriesCodes  = "http://129.241.150.113:8080/v3.1/alpha?fields=name,cca3&codes="
+	CountriesIndex  = "http://129.241.150.113:8080/v3.1/all?fields=name,cca2,cca3,altSpellings" // Everything country search matches on.
 )
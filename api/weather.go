@@ -1,8 +1,18 @@
 package api
 
 const (
-	WeatherCoordinates = "https://geocoding-api.open-meteo.com/v1/search?name="
-	CountShow          = "&count=1"
-	WeatherConditions  = "https://api.open-meteo.com/v1/forecast?"
-	WeatherShow        = "&hourly=temperature_2m&hourly=precipitation"
+	WeatherCoordinates   = "https://geocoding-api.open-meteo.com/v1/search?name="
+	CountShow            = "&count=1"
+	GeocodingCountry     = "&countryCode="
+	WeatherConditions    = "https://api.open-meteo.com/v1/forecast?"
+	WeatherShow          = "&hourly=temperature_2m&hourly=precipitation"
+	WeatherCurrent       = "&current=temperature_2m,precipitation,wind_speed_10m,wind_direction_10m,relative_humidity_2m,cloud_cover,uv_index"
+	WeatherDaily         = "&daily=temperature_2m_min,temperature_2m_max,temperature_2m_mean,precipitation_sum,sunrise,sunset"
+	WeatherTimezone      = "&timezone=auto" // Times and daily aggregates in the location's own timezone.
+	WeatherDays          = "&forecast_days="
+	WeatherImperial      = "&temperature_unit=fahrenheit&wind_speed_unit=mph&precipitation_unit=inch"
+	AirQualityConditions = "https://air-quality-api.open-meteo.com/v1/air-quality?"
+	AirQualityCurrent    = "&current=european_aqi,us_aqi,pm10,pm2_5"
+	WeatherProbe         = "https://api.open-meteo.com/v1/forecast?latitude=0&longitude=0&current=temperature_2m"              // For readiness probes.
+	AirQualityProbe      = "https://air-quality-api.open-meteo.com/v1/air-quality?latitude=0&longitude=0&current=european_aqi" // For readiness probes.
 )
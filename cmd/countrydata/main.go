@@ -0,0 +1,121 @@
+// Command countrydata regenerates the offline country dataset embedded in the handler package
+// from dumps of the countries API. The API answers /v3.1/all with at most ten fields, so the
+// fields the handler reads take three dumps, each with cca2 to join them on:
+//
+//	curl -o all-1.json "https://restcountries.com/v3.1/all?fields=cca2,name,capital,capitalInfo,altSpellings,cca3,ccn3,currencies,latlng,population"
+//	curl -o all-2.json "https://restcountries.com/v3.1/all?fields=cca2,area,languages,borders,region,subregion,timezones,idd,flags,flag"
+//	curl -o all-3.json "https://restcountries.com/v3.1/all?fields=cca2,car"
+//
+// Only the fields the handler reads are kept, one country per line, sorted by two-letter code
+// so regenerating gives small diffs. A field no country in the dumps has is an error, as it
+// means a dump is missing:
+//
+//	go run ./cmd/countrydata -in all-1.json -in all-2.json -in all-3.json -out handler/data/countries.json
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// keep lists the fields of a country the handler package reads; see restCountry there.
+var keep = []string{
+	"name", "capital", "capitalInfo", "altSpellings", "cca2", "cca3", "ccn3", "currencies",
+	"latlng", "population", "area", "languages", "borders", "region", "subregion", "timezones",
+	"idd", "flags", "flag", "car",
+}
+
+// dumps collects the -in flags.
+type dumps []string
+
+func (d *dumps) String() string { return strings.Join(*d, ",") }
+
+func (d *dumps) Set(path string) error {
+	*d = append(*d, path)
+	return nil
+}
+
+func main() {
+	var in dumps
+	flag.Var(&in, "in", "countries API dump to read (a JSON array of countries); repeat to join dumps of different fields")
+	out := flag.String("out", "handler/data/countries.json", "dataset to write")
+	flag.Parse()
+	if len(in) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	n, err := generate(in, *out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d countries to %s", n, *out)
+}
+
+func generate(in []string, out string) (int, error) {
+	// Values are kept as raw JSON, so the order of currencies, which picks the primary one,
+	// survives.
+	countries := map[string]map[string]json.RawMessage{}
+	for _, path := range in {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		var dump []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &dump); err != nil {
+			return 0, fmt.Errorf("error decoding %s: %w", path, err)
+		}
+		for i, fields := range dump {
+			var cca2 string
+			if err := json.Unmarshal(fields["cca2"], &cca2); err != nil || cca2 == "" {
+				return 0, fmt.Errorf("%s: country %d has no cca2", path, i)
+			}
+			if countries[cca2] == nil {
+				countries[cca2] = map[string]json.RawMessage{}
+			}
+			for field, value := range fields {
+				countries[cca2][field] = value
+			}
+		}
+	}
+	for _, field := range keep {
+		found := false
+		for _, country := range countries {
+			if _, found = country[field]; found {
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("no country has %s; dump it too", field)
+		}
+	}
+
+	lines := make([]string, 0, len(countries))
+	codes := make(map[string]string, len(countries))
+	for cca2, country := range countries {
+		kept := map[string]json.RawMessage{}
+		for _, field := range keep {
+			if value, ok := country[field]; ok {
+				kept[field] = value
+			}
+		}
+		var line bytes.Buffer
+		enc := json.NewEncoder(&line)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(kept); err != nil {
+			return 0, err
+		}
+		compact := strings.TrimSpace(line.String())
+		lines = append(lines, compact)
+		codes[compact] = cca2
+	}
+	sort.Slice(lines, func(i, j int) bool { return codes[lines[i]] < codes[lines[j]] })
+
+	dataset := "[\n" + strings.Join(lines, ",\n") + "\n]\n"
+	return len(lines), os.WriteFile(out, []byte(dataset), 0o644)
+}
@@ -2,89 +2,293 @@ package handler
 
 import (
 	"assignment_02/api"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 )
 
 // --------------------------
 // Allowed API Helper Functions
 // --------------------------
 
-func fetchCountryDetails(query string) (name string, capital string, lat float64, lon float64, iso string, currencyCode string, population float64, area float64, err error) {
+// countryInfo holds the fields of the countries API that registrations and dashboards use.
+type countryInfo struct {
+	Name             string
+	Capital          string
+	ISO              string   // Two-letter code.
+	ISO3             string   // Three-letter code.
+	Numeric          string   // Three-digit numeric code.
+	Currency         string   // Primary currency, the first one listed.
+	Currencies       []string // Every currency in use, in the order the countries API lists them.
+	Lat, Lon         float64  // Centre of the country.
+	CapitalLat       float64
+	CapitalLon       float64
+	HasCapitalLatLon bool
+	Population       float64
+	Area             float64
+	Languages        []string // Language names, sorted.
+	Borders          []string // Three-letter codes of neighbouring countries.
+	Region           string
+	Subregion        string
+	Timezones        []string
+	CallingCodes     []string
+	FlagPNG          string
+	FlagSVG          string
+	FlagEmoji        string
+	DrivingSide      string
+	Offline          bool     // Taken from the embedded dataset rather than the countries API.
+	Missing          []string // Fields of the countries API the offline record has no value for.
+}
+
+// lacks reports whether the offline record country was taken from has no value for any of fields.
+func (country countryInfo) lacks(fields ...string) bool {
+	for _, field := range fields {
+		for _, missing := range country.Missing {
+			if field == missing {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fetchCountry looks a country up by its exact name or by any of its ISO codes. With
+// COUNTRY_DATA=primary the embedded dataset answers instead of the countries API.
+func fetchCountry(ctx context.Context, query string) (country countryInfo, err error) {
+	if countryDataMode() == countryDataPrimary {
+		return offlineCountry(query)
+	}
 	trimmed := strings.TrimSpace(query)
 	var reqURL string
-	if len(trimmed) == 2 {
+	if code, ok := countryCode(trimmed); ok {
+		trimmed = code
 		reqURL = fmt.Sprintf("%s%s?fullText=true", api.CountriesAPIIso, strings.ToLower(trimmed))
 	} else {
 		reqURL = fmt.Sprintf("%s%s?fullText=true", api.CountriesApi, strings.ToLower(trimmed))
 	}
 
-	resp, err := http.Get(reqURL)
+	resp, err := upstreamGet(ctx, "countries", reqURL)
 	if err != nil {
 		err = fmt.Errorf("error calling countries API: %w", err)
 		return
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		err = fmt.Errorf("%w: %q", errCountryNotFound, trimmed)
+		return
+	}
 	if resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("countries API returned status %d", resp.StatusCode)
 		return
 	}
 
-	var results []struct {
-		Name struct {
-			Common string `json:"common"`
-		} `json:"name"`
-		Capital    []string `json:"capital"`
-		Cca2       string   `json:"cca2"`
-		Currencies map[string]struct {
-			Name   string `json:"name"`
-			Symbol string `json:"symbol"`
-		} `json:"currencies"`
-		Latlng     []float64 `json:"latlng"`
-		Population float64   `json:"population"`
-		Area       float64   `json:"area"`
-	}
-
+	var results []restCountry
 	if err = json.NewDecoder(resp.Body).Decode(&results); err != nil {
 		err = fmt.Errorf("error decoding countries API response: %w", err)
 		return
 	}
 
 	if len(results) < 1 {
-		err = fmt.Errorf("no results found in countries API")
+		err = fmt.Errorf("%w: %q", errCountryNotFound, trimmed)
 		return
 	}
+	return results[0].info(), nil
+}
+
+// restCountry is a country as the countries API returns it. The offline dataset uses the same
+// form, so cmd/countrydata must keep every field listed here.
+type restCountry struct {
+	Name struct {
+		Common     string `json:"common"`
+		Official   string `json:"official"`
+		NativeName map[string]struct {
+			Official string `json:"official"`
+			Common   string `json:"common"`
+		} `json:"nativeName"`
+	} `json:"name"`
+	Capital     []string `json:"capital"`
+	CapitalInfo struct {
+		Latlng []float64 `json:"latlng"`
+	} `json:"capitalInfo"`
+	AltSpellings []string          `json:"altSpellings"`
+	Cca2         string            `json:"cca2"`
+	Cca3         string            `json:"cca3"`
+	Ccn3         string            `json:"ccn3"`
+	Currencies   currencyCodes     `json:"currencies"`
+	Latlng       []float64         `json:"latlng"`
+	Population   float64           `json:"population"`
+	Area         float64           `json:"area"`
+	Languages    map[string]string `json:"languages"`
+	Borders      []string          `json:"borders"`
+	Region       string            `json:"region"`
+	Subregion    string            `json:"subregion"`
+	Timezones    []string          `json:"timezones"`
+	Idd          struct {
+		Root     string   `json:"root"`
+		Suffixes []string `json:"suffixes"`
+	} `json:"idd"`
+	Flags struct {
+		PNG string `json:"png"`
+		SVG string `json:"svg"`
+	} `json:"flags"`
+	Flag string `json:"flag"` // Emoji.
+	Car  struct {
+		Side string `json:"side"`
+	} `json:"car"`
+}
 
-	res := results[0]
-	name = res.Name.Common
-	iso = res.Cca2
+// info converts res to the fields registrations and dashboards use.
+func (res restCountry) info() (country countryInfo) {
+	country.Name = res.Name.Common
+	country.ISO = res.Cca2
+	country.ISO3 = res.Cca3
+	country.Numeric = res.Ccn3
 	if len(res.Capital) > 0 {
-		capital = res.Capital[0]
+		country.Capital = res.Capital[0]
+	}
+	if len(res.CapitalInfo.Latlng) >= 2 {
+		country.CapitalLat = res.CapitalInfo.Latlng[0]
+		country.CapitalLon = res.CapitalInfo.Latlng[1]
+		country.HasCapitalLatLon = true
 	}
 	if len(res.Latlng) >= 2 {
-		lat = res.Latlng[0]
-		lon = res.Latlng[1]
+		country.Lat = res.Latlng[0]
+		country.Lon = res.Latlng[1]
+	}
+	country.Currencies = res.Currencies
+	if len(res.Currencies) > 0 {
+		country.Currency = res.Currencies[0]
+	}
+	country.Population = res.Population
+	country.Area = res.Area
+	for _, language := range res.Languages {
+		country.Languages = append(country.Languages, language)
+	}
+	sort.Strings(country.Languages)
+	country.Borders = res.Borders
+	country.Region = res.Region
+	country.Subregion = res.Subregion
+	country.Timezones = res.Timezones
+	country.CallingCodes = callingCodes(res.Idd.Root, res.Idd.Suffixes)
+	country.FlagPNG = res.Flags.PNG
+	country.FlagSVG = res.Flags.SVG
+	country.FlagEmoji = res.Flag
+	country.DrivingSide = res.Car.Side
+	return country
+}
+
+// countryCode reports whether query is an ISO country code rather than a name: two or three
+// letters, or up to three digits. Numeric codes are returned padded to three digits.
+func countryCode(query string) (string, bool) {
+	letters, digits := true, true
+	for _, r := range query {
+		letters = letters && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+		digits = digits && r >= '0' && r <= '9'
+	}
+	switch {
+	case letters && (len(query) == 2 || len(query) == 3):
+		return query, true
+	case digits && len(query) >= 1 && len(query) <= 3:
+		return strings.Repeat("0", 3-len(query)) + query, true
+	}
+	return "", false
+}
+
+// hasCode reports whether query is one of the two-letter, three-letter or numeric codes of country.
+func (country countryInfo) hasCode(query string) bool {
+	code, ok := countryCode(strings.TrimSpace(query))
+	return ok && (strings.EqualFold(code, country.ISO) || strings.EqualFold(code, country.ISO3) || code == country.Numeric)
+}
+
+// callingCodes joins an IDD root with its suffixes. Countries sharing a root list many area
+// codes as suffixes (all of "+1" for the United States), so only the root is kept for those.
+func callingCodes(root string, suffixes []string) []string {
+	if root == "" {
+		return nil
+	}
+	if len(suffixes) == 0 || len(suffixes) > 3 {
+		return []string{root}
+	}
+	codes := make([]string, len(suffixes))
+	for i, suffix := range suffixes {
+		codes[i] = root + suffix
+	}
+	return codes
+}
+
+// fetchCountryNames looks up the common names of countries by their three-letter codes.
+func fetchCountryNames(ctx context.Context, codes []string) (map[string]string, error) {
+	if countryDataMode() == countryDataPrimary {
+		return offlineNames(codes)
+	}
+	resp, err := upstreamGet(ctx, "countries", api.CountriesCodes+strings.Join(codes, ","))
+	if err != nil {
+		return nil, fmt.Errorf("error calling countries API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("countries API returned status %d", resp.StatusCode)
+	}
+	var results []struct {
+		Name struct {
+			Common string `json:"common"`
+		} `json:"name"`
+		Cca3 string `json:"cca3"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("error decoding countries API response: %w", err)
 	}
-	for k := range res.Currencies {
-		currencyCode = k
-		break
+	names := make(map[string]string, len(results))
+	for _, res := range results {
+		names[strings.ToUpper(res.Cca3)] = res.Name.Common
 	}
-	population = res.Population
-	area = res.Area
-	return
+	return names, nil
 }
 
-func fetchCurrencyRates(currency string) (map[string]float64, error) {
+// currencyCodes reads the codes of a countries API currencies object in the order they are
+// listed, which puts the country's own currency before foreign ones used alongside it.
+type currencyCodes []string
+
+func (c *currencyCodes) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("currencies must be an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var details json.RawMessage
+		if err := dec.Decode(&details); err != nil {
+			return err
+		}
+		*c = append(*c, strings.ToUpper(tok.(string)))
+	}
+	return nil
+}
+
+func fetchCurrencyRates(ctx context.Context, currency string) (map[string]float64, error) {
 	url := api.CurrencyApi + currency
-	resp, err := http.Get(url)
+	resp, err := upstreamGet(ctx, "currency", url)
 	if err != nil {
 		return nil, fmt.Errorf("error calling currency API: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w %s", errUnknownCurrency, currency)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("currency API returned status %d", resp.StatusCode)
 	}
@@ -94,6 +298,7 @@ func fetchCurrencyRates(currency string) (map[string]float64, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return nil, fmt.Errorf("error decoding currency API response: %w", err)
 	}
+	recordRates(ctx, currency, data.Rates, time.Now())
 	return data.Rates, nil
 }
 
@@ -105,51 +310,213 @@ type GeoResponse struct {
 	} `json:"results"`
 }
 
-func getWeather(city string) (float64, float64, error) {
+// weatherPoint is one hourly sample, with Time in the location's local timezone.
+type weatherPoint struct {
+	Time          string  `json:"time"`
+	Temperature   float64 `json:"temperature"`
+	Precipitation float64 `json:"precipitation"`
+}
+
+// dailyWeather aggregates one local calendar day.
+type dailyWeather struct {
+	Date             string  `json:"date"`
+	Min              float64 `json:"min"`
+	Max              float64 `json:"max"`
+	Mean             float64 `json:"mean"`
+	PrecipitationSum float64 `json:"precipitationSum"`
+	Sunrise          string  `json:"sunrise"`
+	Sunset           string  `json:"sunset"`
+}
+
+// measurement is a value together with the unit the upstream API reports it in.
+type measurement struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// weatherConditions are the current values of the optional weather variables.
+type weatherConditions struct {
+	WindSpeed     measurement
+	WindDirection measurement
+	Humidity      measurement
+	CloudCover    measurement
+	UVIndex       measurement
+}
+
+// weatherReport is everything getWeather retrieves for one location.
+type weatherReport struct {
+	Location   weatherLocation
+	Timezone   string
+	Current    weatherPoint
+	Conditions weatherConditions
+	Hourly     []weatherPoint
+	Daily      []dailyWeather
+}
+
+// maxForecastDays is the longest forecast the weather API offers.
+const maxForecastDays = 16
+
+// geocodeCity looks up the coordinates of city, restricted to the country with the given
+// ISO code when one is known.
+func geocodeCity(ctx context.Context, city, countryCode string) (weatherLocation, error) {
 	geoURL := api.WeatherCoordinates + url.QueryEscape(city) + api.CountShow
-	geoResp, err := http.Get(geoURL)
+	if countryCode != "" {
+		geoURL += api.GeocodingCountry + url.QueryEscape(strings.ToUpper(countryCode))
+	}
+	geoResp, err := upstreamGet(ctx, "geocoding", geoURL)
 	if err != nil {
-		return 0, 0, fmt.Errorf("error calling geocoding API: %w", err)
+		return weatherLocation{}, fmt.Errorf("error calling geocoding API: %w", err)
 	}
 	defer geoResp.Body.Close()
 	if geoResp.StatusCode != http.StatusOK {
-		return 0, 0, fmt.Errorf("geocoding API returned status %d", geoResp.StatusCode)
+		return weatherLocation{}, fmt.Errorf("geocoding API returned status %d", geoResp.StatusCode)
 	}
 	var geoData GeoResponse
 	if err := json.NewDecoder(geoResp.Body).Decode(&geoData); err != nil {
-		return 0, 0, fmt.Errorf("error decoding geocoding API response: %w", err)
+		return weatherLocation{}, fmt.Errorf("error decoding geocoding API response: %w", err)
 	}
 	if len(geoData.Results) < 1 {
-		return 0, 0, fmt.Errorf("no geocoding results found")
+		return weatherLocation{}, fmt.Errorf("no geocoding results found for %q", city)
 	}
-	lat := geoData.Results[0].Latitude
-	lon := geoData.Results[0].Longitude
+	result := geoData.Results[0]
+	return weatherLocation{Name: result.Name, Latitude: result.Latitude, Longitude: result.Longitude}, nil
+}
 
-	weatherURL := fmt.Sprintf("%slatitude=%f&longitude=%f%s", api.WeatherConditions, lat, lon, api.WeatherShow)
-	weatherResp, err := http.Get(weatherURL)
+// getWeather fetches current conditions plus hourly samples and daily aggregates at loc for the
+// given number of days, starting today in the location's timezone. Imperial units give °F,
+// inches and mph instead of °C, millimetres and km/h.
+func getWeather(ctx context.Context, loc weatherLocation, days int, imperial bool) (weatherReport, error) {
+	var report weatherReport
+	lat, lon := loc.Latitude, loc.Longitude
+
+	if days < 1 {
+		days = 1
+	}
+	weatherURL := fmt.Sprintf("%slatitude=%f&longitude=%f%s%s%s%s%s%d", api.WeatherConditions, lat, lon,
+		api.WeatherShow, api.WeatherCurrent, api.WeatherDaily, api.WeatherTimezone, api.WeatherDays, days)
+	if imperial {
+		weatherURL += api.WeatherImperial
+	}
+	weatherResp, err := upstreamGet(ctx, "weather", weatherURL)
 	if err != nil {
-		return 0, 0, fmt.Errorf("error calling weather API: %w", err)
+		return report, fmt.Errorf("error calling weather API: %w", err)
 	}
 	defer weatherResp.Body.Close()
 	if weatherResp.StatusCode != http.StatusOK {
-		return 0, 0, fmt.Errorf("weather API returned status %d", weatherResp.StatusCode)
+		return report, fmt.Errorf("weather API returned status %d", weatherResp.StatusCode)
 	}
 	var weatherData struct {
-		Hourly struct {
+		Timezone string `json:"timezone"`
+		Current  struct {
+			Time             string  `json:"time"`
+			Temperature2m    float64 `json:"temperature_2m"`
+			Precipitation    float64 `json:"precipitation"`
+			WindSpeed10m     float64 `json:"wind_speed_10m"`
+			WindDirection10m float64 `json:"wind_direction_10m"`
+			Humidity2m       float64 `json:"relative_humidity_2m"`
+			CloudCover       float64 `json:"cloud_cover"`
+			UVIndex          float64 `json:"uv_index"`
+		} `json:"current"`
+		CurrentUnits map[string]string `json:"current_units"`
+		Hourly       struct {
+			Time          []string  `json:"time"`
 			Temperature2m []float64 `json:"temperature_2m"`
 			Precipitation []float64 `json:"precipitation"`
 		} `json:"hourly"`
+		Daily struct {
+			Time             []string  `json:"time"`
+			Temperature2mMin []float64 `json:"temperature_2m_min"`
+			Temperature2mMax []float64 `json:"temperature_2m_max"`
+			Temperature2mAvg []float64 `json:"temperature_2m_mean"`
+			PrecipitationSum []float64 `json:"precipitation_sum"`
+			Sunrise          []string  `json:"sunrise"`
+			Sunset           []string  `json:"sunset"`
+		} `json:"daily"`
 	}
 	if err := json.NewDecoder(weatherResp.Body).Decode(&weatherData); err != nil {
-		return 0, 0, fmt.Errorf("error decoding weather API response: %w", err)
+		return report, fmt.Errorf("error decoding weather API response: %w", err)
+	}
+	if weatherData.Current.Time == "" {
+		return report, fmt.Errorf("weather API returned no current conditions")
+	}
+
+	report.Location = loc
+	report.Timezone = weatherData.Timezone
+	report.Current = weatherPoint{
+		Time:          weatherData.Current.Time,
+		Temperature:   weatherData.Current.Temperature2m,
+		Precipitation: weatherData.Current.Precipitation,
 	}
-	temp := -99.0
-	precip := -99.0
-	if len(weatherData.Hourly.Temperature2m) > 0 {
-		temp = weatherData.Hourly.Temperature2m[0]
+	current, units := weatherData.Current, weatherData.CurrentUnits
+	report.Conditions = weatherConditions{
+		WindSpeed:     measurement{current.WindSpeed10m, units["wind_speed_10m"]},
+		WindDirection: measurement{current.WindDirection10m, units["wind_direction_10m"]},
+		Humidity:      measurement{current.Humidity2m, units["relative_humidity_2m"]},
+		CloudCover:    measurement{current.CloudCover, units["cloud_cover"]},
+		UVIndex:       measurement{current.UVIndex, units["uv_index"]},
+	}
+	hourly := weatherData.Hourly
+	for i := range hourly.Time {
+		if i < len(hourly.Temperature2m) && i < len(hourly.Precipitation) {
+			report.Hourly = append(report.Hourly, weatherPoint{hourly.Time[i], hourly.Temperature2m[i], hourly.Precipitation[i]})
+		}
+	}
+	daily := weatherData.Daily
+	for i := range daily.Time {
+		if i < len(daily.Temperature2mMin) && i < len(daily.Temperature2mMax) && i < len(daily.Temperature2mAvg) && i < len(daily.PrecipitationSum) {
+			day := dailyWeather{daily.Time[i], daily.Temperature2mMin[i], daily.Temperature2mMax[i], daily.Temperature2mAvg[i], daily.PrecipitationSum[i], "", ""}
+			if i < len(daily.Sunrise) && i < len(daily.Sunset) {
+				day.Sunrise, day.Sunset = daily.Sunrise[i], daily.Sunset[i]
+			}
+			report.Daily = append(report.Daily, day)
+		}
+	}
+	return report, nil
+}
+
+// airQuality holds the current air quality indices and particulate matter concentrations.
+type airQuality struct {
+	Time        string      `json:"time"`
+	EuropeanAQI measurement `json:"europeanAqi"`
+	USAQI       measurement `json:"usAqi"`
+	PM10        measurement `json:"pm10"`
+	PM25        measurement `json:"pm2_5"`
+}
+
+// getAirQuality fetches the current air quality at the given coordinates.
+func getAirQuality(ctx context.Context, lat, lon float64) (airQuality, error) {
+	var quality airQuality
+	aqURL := fmt.Sprintf("%slatitude=%f&longitude=%f%s%s", api.AirQualityConditions, lat, lon, api.AirQualityCurrent, api.WeatherTimezone)
+	resp, err := upstreamGet(ctx, "airquality", aqURL)
+	if err != nil {
+		return quality, fmt.Errorf("error calling air quality API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return quality, fmt.Errorf("air quality API returned status %d", resp.StatusCode)
+	}
+	var data struct {
+		Current struct {
+			Time        string  `json:"time"`
+			EuropeanAQI float64 `json:"european_aqi"`
+			USAQI       float64 `json:"us_aqi"`
+			PM10        float64 `json:"pm10"`
+			PM25        float64 `json:"pm2_5"`
+		} `json:"current"`
+		CurrentUnits map[string]string `json:"current_units"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return quality, fmt.Errorf("error decoding air quality API response: %w", err)
 	}
-	if len(weatherData.Hourly.Precipitation) > 0 {
-		precip = weatherData.Hourly.Precipitation[0]
+	if data.Current.Time == "" {
+		return quality, fmt.Errorf("air quality API returned no current values")
 	}
-	return temp, precip, nil
+	units := data.CurrentUnits
+	return airQuality{
+		Time:        data.Current.Time,
+		EuropeanAQI: measurement{data.Current.EuropeanAQI, units["european_aqi"]},
+		USAQI:       measurement{data.Current.USAQI, units["us_aqi"]},
+		PM10:        measurement{data.Current.PM10, units["pm10"]},
+		PM25:        measurement{data.Current.PM25, units["pm2_5"]},
+	}, nil
 }
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --------------------------
+// API Key Authentication
+// --------------------------
+
+// APIKeyHeader carries the client's API key. "Authorization: Bearer <key>" is accepted as well.
+const APIKeyHeader = "X-API-Key"
+
+type callerKey struct{}
+
+// caller returns the API key that authenticated the request, as set by RequireAPIKey.
+func caller(ctx context.Context) APIKey {
+	key, _ := ctx.Value(callerKey{}).(APIKey)
+	return key
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// credentialFrom extracts the presented key from the X-API-Key or Authorization header.
+func credentialFrom(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get(APIKeyHeader)); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// lookupAPIKey finds the stored key matching the presented plaintext key.
+func lookupAPIKey(presented string) (APIKey, bool) {
+	hash := hashKey(presented)
+	appCache.RLock()
+	defer appCache.RUnlock()
+	for _, key := range appCache.Keys {
+		if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) == 1 {
+			return key, true
+		}
+	}
+	return APIKey{}, false
+}
+
+// canAccess reports whether the caller may see a resource owned by the given key ID.
+// Admins see everything. Resources of other keys are reported as not found, so their
+// existence is not revealed.
+func canAccess(ctx context.Context, owner string) bool {
+	return isAdmin(ctx) || owner == principal(ctx)
+}
+
+// RequireAPIKey rejects requests without a valid API key and stores the key in the request context.
+func RequireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		presented := credentialFrom(r)
+		if presented == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dashboard"`)
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+		key, ok := lookupAPIKey(presented)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dashboard"`)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, key)))
+	}
+}
+
+// requireAdmin accepts either the ADMIN_TOKEN environment variable (used to bootstrap the
+// first keys) or an API key whose role may manage keys.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	presented := credentialFrom(r)
+	token := os.Getenv("ADMIN_TOKEN")
+	if presented != "" && token != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+		return true
+	}
+	if key, ok := lookupAPIKey(presented); ok && presented != "" {
+		if !key.can(permManageKeys) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="dashboard-admin"`)
+	http.Error(w, "Admin credentials required", http.StatusUnauthorized)
+	return false
+}
+
+// KeysHandler manages API keys under /dashboard/v1/admin/keys/.
+func KeysHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) > 5 && pathParts[5] != "" {
+		switch r.Method {
+		case http.MethodDelete:
+			handleDeleteKey(w, r, pathParts[5])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		handleCreateKey(w, r)
+	case http.MethodGet:
+		handleListKeys(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleCreateKey(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name  string `json:"name"`
+		Role  Role   `json:"role"`
+		Owner string `json:"owner"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if body.Role == "" {
+		body.Role = RoleEditor
+	}
+	if !validRole(body.Role) {
+		http.Error(w, "Unknown role, expected viewer, editor or admin", http.StatusBadRequest)
+		return
+	}
+	if body.Owner != "" {
+		appCache.RLock()
+		_, exists := appCache.Keys[body.Owner]
+		appCache.RUnlock()
+		if !exists {
+			http.Error(w, "Owner key not found", http.StatusBadRequest)
+			return
+		}
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, "Could not generate key", http.StatusInternalServerError)
+		return
+	}
+	plaintext := "dk_" + hex.EncodeToString(secret)
+	key := APIKey{
+		ID:      generateID(),
+		Name:    body.Name,
+		Hash:    hashKey(plaintext),
+		Created: time.Now().Format(time.RFC3339),
+		Role:    body.Role,
+		Owner:   body.Owner,
+	}
+	appCache.Lock()
+	appCache.Keys[key.ID] = key
+	appCache.Unlock()
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
+	}
+	slog.InfoContext(r.Context(), "API key created", "key", key.ID, "name", key.Name, "role", key.Role)
+
+	// The plaintext key is only ever returned here.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":      key.ID,
+		"name":    key.Name,
+		"key":     plaintext,
+		"created": key.Created,
+		"role":    string(key.Role),
+		"owner":   key.Owner,
+	})
+}
+
+func handleListKeys(w http.ResponseWriter, r *http.Request) {
+	appCache.RLock()
+	keys := []map[string]string{}
+	for _, key := range appCache.Keys {
+		keys = append(keys, map[string]string{
+			"id":      key.ID,
+			"name":    key.Name,
+			"created": key.Created,
+			"role":    string(key.effectiveRole()),
+			"owner":   key.Owner,
+		})
+	}
+	appCache.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func handleDeleteKey(w http.ResponseWriter, r *http.Request, id string) {
+	appCache.Lock()
+	if _, exists := appCache.Keys[id]; !exists {
+		appCache.Unlock()
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	delete(appCache.Keys, id)
+	appCache.Unlock()
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
+	}
+	slog.InfoContext(r.Context(), "API key revoked", "key", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,30 +1,107 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // --------------------------
 // Cache Persistence Functions
 // --------------------------
 
-func LoadCache() error {
+// loaded is set once the cache file has been read successfully; used by the readiness check.
+var loaded atomic.Bool
+
+// LoadCache reads the cache file into appCache. A missing file is a first start, with nothing
+// stored yet, and counts as loaded; a file that cannot be read or parsed does not.
+func LoadCache() (err error) {
+	_, span := tracer.Start(context.Background(), "cache.load", trace.WithAttributes(attribute.String("file", cacheFile)))
+	defer func() { endSpan(span, err) }()
+	defer func() { loaded.Store(err == nil) }()
+
 	data, err := os.ReadFile(cacheFile)
+	if os.IsNotExist(err) {
+		slog.Info("no cache file yet, starting empty", "file", cacheFile)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 	appCache.Lock()
 	defer appCache.Unlock()
-	return json.Unmarshal(data, &appCache)
+	if err := json.Unmarshal(data, &appCache.cacheData); err != nil {
+		return err
+	}
+	if appCache.Keys == nil {
+		appCache.Keys = make(map[string]APIKey)
+	}
+	if appCache.Comparisons == nil {
+		appCache.Comparisons = make(map[string]Comparison)
+	}
+	if appCache.RateHistory == nil {
+		appCache.RateHistory = make(map[string]dailyRates)
+	}
+	adoptLegacyRecords(envOr("LEGACY_OWNER", ""))
+	return nil
+}
+
+// adoptLegacyRecords gives registrations and webhooks stored before API keys existed, which have
+// no owner, to the key with the given ID. Without an owner only admins can see them, so they are
+// left as they are, with a warning, when owner is empty or not a known key. Callers hold the lock.
+func adoptLegacyRecords(owner string) {
+	unowned := 0
+	for _, config := range appCache.Configs {
+		if config.Owner == "" {
+			unowned++
+		}
+	}
+	for _, webhook := range appCache.Webhooks {
+		if webhook.Owner == "" {
+			unowned++
+		}
+	}
+	if unowned == 0 {
+		return
+	}
+	if _, exists := appCache.Keys[owner]; !exists {
+		slog.Warn("records without an owner are only visible to admins; set LEGACY_OWNER to the ID of a key to give them to it",
+			"records", unowned, "legacy_owner", owner)
+		return
+	}
+	for id, config := range appCache.Configs {
+		if config.Owner == "" {
+			config.Owner = owner
+			appCache.Configs[id] = config
+		}
+	}
+	for id, webhook := range appCache.Webhooks {
+		if webhook.Owner == "" {
+			webhook.Owner = owner
+			appCache.Webhooks[id] = webhook
+		}
+	}
+	slog.Info("gave records without an owner to LEGACY_OWNER", "records", unowned, "legacy_owner", owner)
 }
 
-func saveCache() error {
+func cacheLoaded() bool {
+	return loaded.Load()
+}
+
+func saveCache(ctx context.Context) (err error) {
+	_, span := tracer.Start(ctx, "cache.save", trace.WithAttributes(attribute.String("file", cacheFile)))
+	defer func() { endSpan(span, err) }()
+
 	appCache.RLock()
 	defer appCache.RUnlock()
-	data, err := json.MarshalIndent(appCache, "", "  ")
+	data, err := json.MarshalIndent(appCache.cacheData, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------
+// Circuit Breakers and Outbound Rate Limits
+// --------------------------
+
+// ErrCircuitOpen is returned for calls to an upstream API whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// ErrUpstreamThrottled is returned when the outbound rate limit for an upstream API is exhausted.
+var ErrUpstreamThrottled = errors.New("outbound rate limit exceeded")
+
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "closed"
+	breakerOpen     breakerState = "open"
+	breakerHalfOpen breakerState = "half-open"
+)
+
+// circuitBreaker opens after a number of consecutive failures, rejects calls for a cooldown,
+// then lets a single probe through (half-open). A successful probe closes it again.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+// allow reports whether a call may be made now.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call and returns the state it ended up in.
+func (b *circuitBreaker) record(success bool, now time.Time) breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		return b.state
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+	return b.state
+}
+
+// release gives back a half-open probe slot when the call was never made.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// status describes the breaker for the status endpoint.
+func (b *circuitBreaker) status() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := map[string]interface{}{
+		"state":    b.state,
+		"failures": b.failures,
+	}
+	if b.state != breakerClosed {
+		status["openedAt"] = b.openedAt.Format(time.RFC3339)
+	}
+	return status
+}
+
+// upstreamGuard holds the breaker and outbound limiter for one upstream API.
+type upstreamGuard struct {
+	breaker *circuitBreaker
+	limiter *routeLimiter
+}
+
+var (
+	guardsMu sync.Mutex
+	guards   = map[string]*upstreamGuard{}
+)
+
+// UpstreamClock tells the breakers and outbound rate limits the time. Tests replace it to move
+// through cooldowns without waiting.
+var UpstreamClock = time.Now
+
+// ResetUpstreamGuards closes every breaker and refills every outbound rate limit, by having them
+// created again from the environment on their next use.
+func ResetUpstreamGuards() {
+	guardsMu.Lock()
+	guards = map[string]*upstreamGuard{}
+	guardsMu.Unlock()
+}
+
+// guardFor returns the guard for apiName, creating it from the environment on first use:
+// UPSTREAM_BREAKER_FAILURES (default 5), UPSTREAM_BREAKER_COOLDOWN (default 30s) and
+// UPSTREAM_RATE_LIMIT_<API> or UPSTREAM_RATE_LIMIT_DEFAULT in calls per minute (default 600).
+func guardFor(apiName string) *upstreamGuard {
+	guardsMu.Lock()
+	defer guardsMu.Unlock()
+	if g, ok := guards[apiName]; ok {
+		return g
+	}
+	threshold, err := strconv.Atoi(envOr("UPSTREAM_BREAKER_FAILURES", "5"))
+	if err != nil || threshold <= 0 {
+		threshold = 5
+	}
+	cooldown, err := envDuration("UPSTREAM_BREAKER_COOLDOWN", 30*time.Second)
+	if err != nil || cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	perMinute, err := strconv.Atoi(envOr("UPSTREAM_RATE_LIMIT_"+strings.ToUpper(apiName), envOr("UPSTREAM_RATE_LIMIT_DEFAULT", "600")))
+	if err != nil || perMinute <= 0 {
+		perMinute = 600
+	}
+	g := &upstreamGuard{
+		breaker: &circuitBreaker{threshold: threshold, cooldown: cooldown, state: breakerClosed},
+		limiter: &routeLimiter{capacity: float64(perMinute), rate: float64(perMinute) / 60, buckets: make(map[string]*bucket)},
+	}
+	guards[apiName] = g
+	return g
+}
+
+// upstreamAPIs are the names upstreamGet is called with.
+var upstreamAPIs = []string{"airquality", "countries", "currency", "geocoding", "weather"}
+
+// breakerStatuses reports the state of every upstream breaker.
+func breakerStatuses() map[string]interface{} {
+	statuses := make(map[string]interface{}, len(upstreamAPIs))
+	for _, name := range upstreamAPIs {
+		statuses[name] = guardFor(name).breaker.status()
+	}
+	return statuses
+}
+
+// maxUpstreamWait is how long a call may wait for an outbound rate limit token before giving up.
+const maxUpstreamWait = time.Second
+
+// acquire checks the breaker and takes an outbound rate limit token, waiting briefly if needed.
+func (g *upstreamGuard) acquire(ctx context.Context, apiName string) error {
+	now := UpstreamClock()
+	if !g.breaker.allow(now) {
+		return fmt.Errorf("%s: %w", apiName, ErrCircuitOpen)
+	}
+	ok, _, _, retryAfter := g.limiter.allow(apiName, now)
+	if ok {
+		return nil
+	}
+	if retryAfter > maxUpstreamWait {
+		g.breaker.release()
+		return fmt.Errorf("%s: %w", apiName, ErrUpstreamThrottled)
+	}
+	timer := time.NewTimer(retryAfter)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		g.breaker.release()
+		return ctx.Err()
+	case <-timer.C:
+	}
+	if ok, _, _, _ := g.limiter.allow(apiName, UpstreamClock()); !ok {
+		g.breaker.release()
+		return fmt.Errorf("%s: %w", apiName, ErrUpstreamThrottled)
+	}
+	return nil
+}
+
+// done records the outcome of a call made after acquire.
+func (g *upstreamGuard) done(ctx context.Context, apiName string, success bool) {
+	before := g.breaker.status()["state"]
+	after := g.breaker.record(success, UpstreamClock())
+	if before != after {
+		slog.WarnContext(ctx, "circuit breaker changed state", "api", apiName, "from", before, "to", after)
+	}
+}
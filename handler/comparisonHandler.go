@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------
+// Comparison Dashboards
+// --------------------------
+
+// maxComparisonEntries caps the countries in one comparison, since each is a full dashboard.
+const maxComparisonEntries = 10
+
+// ComparisonHandler manages comparisons under /dashboard/v1/comparisons/. Getting a single
+// comparison returns it populated, with one row per country and rankings.
+func ComparisonHandler(w http.ResponseWriter, r *http.Request) {
+	perm := permManageRegistrations
+	if r.Method == http.MethodGet {
+		perm = permViewDashboards
+	}
+	if !requirePermission(w, r, perm) {
+		return
+	}
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) > 4 && pathParts[4] != "" {
+		switch r.Method {
+		case http.MethodGet:
+			handleGetComparison(w, r, pathParts[4])
+		case http.MethodDelete:
+			handleDeleteComparison(w, r, pathParts[4])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		handleCreateComparison(w, r)
+	case http.MethodGet:
+		handleListComparisons(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleCreateComparison(w http.ResponseWriter, r *http.Request) {
+	var comparison Comparison
+	if err := json.NewDecoder(r.Body).Decode(&comparison); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	for i, iso := range comparison.ISOCodes {
+		comparison.ISOCodes[i] = strings.ToUpper(strings.TrimSpace(iso))
+	}
+	comparison.BaseCurrency = strings.ToUpper(strings.TrimSpace(comparison.BaseCurrency))
+	if err := validateComparison(r.Context(), comparison); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Every code is looked up, the offline dataset standing in for the countries API when it
+	// fails, and kept in its two-letter form. The lookup also resolves names, so the country
+	// found has to have the code asked for.
+	for i, iso := range comparison.ISOCodes {
+		country, err := lookupCountry(r.Context(), iso)
+		if err == nil && !country.hasCode(iso) {
+			err = fmt.Errorf("%w: %q", errCountryNotFound, iso)
+		}
+		if errors.Is(err, errCountryNotFound) {
+			http.Error(w, fmt.Sprintf("ISO code %q is not a known country code", iso), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.WarnContext(r.Context(), "error looking up comparison country", "iso", iso, "error", err)
+			http.Error(w, fmt.Sprintf("Could not look up ISO code %q", iso), http.StatusBadGateway)
+			return
+		}
+		comparison.ISOCodes[i] = strings.ToUpper(country.ISO)
+	}
+	comparison.ID = generateID()
+	comparison.Owner = principal(r.Context())
+	comparison.LastChange = time.Now().Format("20060102 15:04")
+	appCache.Lock()
+	appCache.Comparisons[comparison.ID] = comparison
+	appCache.Unlock()
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
+	}
+	slog.InfoContext(r.Context(), "comparison created", "id", comparison.ID, "entries", len(comparison.Registrations)+len(comparison.ISOCodes))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// validateComparison checks that a comparison has between 2 and maxComparisonEntries countries,
+// that the caller can see every referenced registration and that its features are valid.
+func validateComparison(ctx context.Context, comparison Comparison) error {
+	entries := len(comparison.Registrations) + len(comparison.ISOCodes)
+	if entries < 2 || entries > maxComparisonEntries {
+		return fmt.Errorf("a comparison needs between 2 and %d registrations or ISO codes", maxComparisonEntries)
+	}
+	appCache.RLock()
+	defer appCache.RUnlock()
+	for _, id := range comparison.Registrations {
+		config, exists := appCache.Configs[id]
+		if !exists || !canAccess(ctx, config.Owner) {
+			return fmt.Errorf("registration %q not found", id)
+		}
+	}
+	for _, iso := range comparison.ISOCodes {
+		if _, ok := countryCode(iso); !ok {
+			return fmt.Errorf("ISO code %q must be a two- or three-letter or numeric country code", iso)
+		}
+	}
+	if comparison.BaseCurrency != "" && !isCurrencyCode(comparison.BaseCurrency) {
+		return fmt.Errorf("base currency %q must be a three-letter code", comparison.BaseCurrency)
+	}
+	return validateFeatures(comparison.Features)
+}
+
+func handleListComparisons(w http.ResponseWriter, r *http.Request) {
+	appCache.RLock()
+	defer appCache.RUnlock()
+	comparisons := []Comparison{}
+	for _, comparison := range appCache.Comparisons {
+		if canAccess(r.Context(), comparison.Owner) {
+			comparisons = append(comparisons, comparison)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparisons)
+}
+
+func handleDeleteComparison(w http.ResponseWriter, r *http.Request, id string) {
+	appCache.Lock()
+	comparison, exists := appCache.Comparisons[id]
+	if !exists || !canAccess(r.Context(), comparison.Owner) {
+		appCache.Unlock()
+		http.Error(w, "Comparison not found", http.StatusNotFound)
+		return
+	}
+	delete(appCache.Comparisons, id)
+	appCache.Unlock()
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
+	}
+	slog.InfoContext(r.Context(), "comparison deleted", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// comparisonRow is one country of a populated comparison.
+type comparisonRow struct {
+	populated interface{} // *dashboardResponse, or an error for a missing registration.
+	features  map[string]interface{}
+	display   Display // The settings the features are shown with.
+	isoCode   string
+	country   string
+	currency  string
+}
+
+func handleGetComparison(w http.ResponseWriter, r *http.Request, id string) {
+	appCache.RLock()
+	comparison, exists := appCache.Comparisons[id]
+	appCache.RUnlock()
+	if !exists || !canAccess(r.Context(), comparison.Owner) {
+		http.Error(w, "Comparison not found", http.StatusNotFound)
+		return
+	}
+
+	// The display settings in the query are the comparison's: its rankings are in their units,
+	// and every timestamp in it uses their time format and timezone.
+	display, err := displayFor(nil, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows := populateComparison(r.Context(), comparison, r.URL.Query(), display)
+	countries := make([]interface{}, len(rows))
+	for i, row := range rows {
+		countries[i] = row.populated
+	}
+	result := map[string]interface{}{
+		"id":            comparison.ID,
+		"name":          comparison.Name,
+		"countries":     countries,
+		"rankings":      rankComparison(r.Context(), comparison, rows, display),
+		"units":         display.units(),
+		"lastRetrieval": display.formatTime(time.Now()),
+	}
+	if comparison.BaseCurrency != "" {
+		result["baseCurrency"] = comparison.BaseCurrency
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// populateComparison builds a dashboard with the comparison's features for every entry,
+// concurrently, in the order registrations then ISO codes were given. Registrations are shown
+// with their own display settings and those in query, as their dashboards are, but with the
+// time format and timezone of display.
+func populateComparison(ctx context.Context, comparison Comparison, query url.Values, display Display) []comparisonRow {
+	configs := make([]DashboardConfig, 0, len(comparison.Registrations)+len(comparison.ISOCodes))
+	missing := map[int]string{}
+	appCache.RLock()
+	for _, id := range comparison.Registrations {
+		config, exists := appCache.Configs[id]
+		if !exists || !canAccess(ctx, config.Owner) {
+			missing[len(configs)] = id
+		}
+		config.ID = id
+		config.Features = comparison.Features
+		config.Locations = nil
+		configs = append(configs, config)
+	}
+	appCache.RUnlock()
+	for _, iso := range comparison.ISOCodes {
+		configs = append(configs, DashboardConfig{ISOCode: iso, Features: comparison.Features})
+	}
+
+	rows := make([]comparisonRow, len(configs))
+	var wg sync.WaitGroup
+	for i, config := range configs {
+		if id, ok := missing[i]; ok {
+			rows[i] = comparisonRow{populated: map[string]interface{}{"registration": id, "error": "registration not found"}}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, config DashboardConfig) {
+			defer wg.Done()
+			if config.Currency == "" {
+				// Countries given by ISO code only need their name and currency looked up first.
+				if country, _, ok := resolveCountry(ctx, config.ISOCode); ok {
+					config.Country = country.Name
+					config.Currency = strings.ToUpper(country.Currency)
+				}
+			}
+			rowDisplay, err := displayFor(config.Display, query)
+			if err != nil {
+				rowDisplay = display
+			}
+			rowDisplay.TimeFormat, rowDisplay.Timezone = display.TimeFormat, display.Timezone
+			populated, fs := populateDashboard(ctx, config, dashboardOptions{Display: rowDisplay})
+			populated.Registration = config.ID
+			rows[i] = comparisonRow{
+				populated: populated,
+				features:  fs.features,
+				display:   rowDisplay,
+				isoCode:   config.ISOCode,
+				country:   config.Country,
+				currency:  config.Currency,
+			}
+		}(i, config)
+	}
+	wg.Wait()
+	return rows
+}
+
+// rankEntry is one place in a ranking.
+type rankEntry struct {
+	Rank    int     `json:"rank"`
+	ISOCode string  `json:"isoCode"`
+	Country string  `json:"country"`
+	Value   float64 `json:"value"`
+}
+
+// rankComparison ranks the rows, highest first, by population, area and temperature when those
+// features are enabled, and by the value of their currency in the base currency when one is set.
+// Values are given in the units of display, whatever units their row is shown in.
+func rankComparison(ctx context.Context, comparison Comparison, rows []comparisonRow, display Display) map[string][]rankEntry {
+	rankings := map[string][]rankEntry{}
+	rank := func(name string, value func(comparisonRow) (float64, bool)) {
+		entries := []rankEntry{}
+		for _, row := range rows {
+			if v, ok := value(row); ok {
+				entries = append(entries, rankEntry{ISOCode: row.isoCode, Country: row.country, Value: v})
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Value > entries[j].Value })
+		for i := range entries {
+			entries[i].Rank = i + 1
+		}
+		rankings[name] = entries
+	}
+	feature := func(field string) func(comparisonRow) (float64, bool) {
+		return func(row comparisonRow) (float64, bool) {
+			v, ok := row.features[field].(float64)
+			return convertUnits(field, v, row.display, display), ok
+		}
+	}
+	if comparison.Features.Population {
+		rank("population", feature("population"))
+	}
+	if comparison.Features.Area {
+		rank("area", feature("area"))
+	}
+	if comparison.Features.Temperature {
+		rank("temperature", feature("temperature"))
+	}
+	if comparison.BaseCurrency != "" {
+		fetched, err := fetchCurrencyRates(ctx, comparison.BaseCurrency)
+		if err != nil {
+			slog.WarnContext(ctx, "error fetching currency rates", "base", comparison.BaseCurrency, "error", err)
+		}
+		rates, _, ok := lastRates.resolve(comparison.BaseCurrency, fetched, err)
+		// A rate is units of the country's currency per base unit, so one unit is worth 1/rate.
+		rank("currency", func(row comparisonRow) (float64, bool) {
+			if row.currency == comparison.BaseCurrency {
+				return 1, row.currency != ""
+			}
+			rate, found := rates[row.currency]
+			return 1 / rate, ok && found && rate > 0
+		})
+	}
+	return rankings
+}
+
+// convertUnits converts the value of a ranked feature, shown in the units of from, to the units
+// of to.
+func convertUnits(field string, v float64, from, to Display) float64 {
+	if from.imperial() == to.imperial() {
+		return v
+	}
+	switch field {
+	case "area":
+		if to.imperial() {
+			return v * squareMilesPerKm2
+		}
+		return v / squareMilesPerKm2
+	case "temperature":
+		if to.imperial() {
+			return v*9/5 + 32
+		}
+		return (v - 32) * 5 / 9
+	}
+	return v
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// --------------------------
+// Environment Configuration Helpers
+// --------------------------
+
+// envOr returns the value of the environment variable key, or def if it is unset or blank.
+func envOr(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList splits a comma separated environment variable into lower-cased, trimmed entries.
+func envList(key, def string) []string {
+	var list []string
+	for _, part := range strings.Split(envOr(key, def), ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// envDuration parses a duration such as "2s" or "500ms" from the environment.
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := envOr(key, "")
+	if v == "" {
+		return def, nil
+	}
+	return time.ParseDuration(v)
+}
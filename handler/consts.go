@@ -6,22 +6,83 @@ import (
 )
 
 type Features struct {
-	Temperature      bool     `json:"temperature"`
-	Precipitation    bool     `json:"precipitation"`
-	Capital          bool     `json:"capital"`
-	Coordinates      bool     `json:"coordinates"`
-	Population       bool     `json:"population"`
-	Area             bool     `json:"area"`
-	TargetCurrencies []string `json:"targetCurrencies"`
+	Temperature       bool            `json:"temperature"`   // Temperature at the current hour.
+	Precipitation     bool            `json:"precipitation"` // Precipitation at the current hour.
+	Capital           bool            `json:"capital"`
+	Coordinates       bool            `json:"coordinates"`
+	Population        bool            `json:"population"`
+	Area              bool            `json:"area"`
+	TargetCurrencies  []string        `json:"targetCurrencies"`
+	Current           bool            `json:"current"` // Current conditions with local time.
+	Today             bool            `json:"today"`   // Today's min/max/mean temperature and precipitation sum.
+	Forecast          ForecastFeature `json:"forecast"`
+	Wind              bool            `json:"wind"`       // Wind speed and direction at 10 m.
+	Humidity          bool            `json:"humidity"`   // Relative humidity at 2 m.
+	CloudCover        bool            `json:"cloudCover"` // Total cloud cover.
+	UVIndex           bool            `json:"uvIndex"`
+	Sun               bool            `json:"sun"`             // Today's sunrise and sunset in local time.
+	AirQuality        bool            `json:"airQuality"`      // European and US AQI plus PM10 and PM2.5.
+	CurrencyHistory   int             `json:"currencyHistory"` // Days of recorded target currency rates; 0 disables.
+	CurrencyChange    bool            `json:"currencyChange"`  // Percent change of target currency rates over a day and a week.
+	AllCurrencies     bool            `json:"allCurrencies"`   // Target currency rates against each of the country's currencies.
+	Languages         bool            `json:"languages"`       // Official languages by name.
+	Borders           bool            `json:"borders"`         // Neighbouring countries with their codes and names.
+	Region            bool            `json:"region"`          // Region and subregion.
+	Timezones         bool            `json:"timezones"`
+	CallingCodes      bool            `json:"callingCodes"`      // International dialling prefixes, e.g. "+47".
+	Flag              bool            `json:"flag"`              // Flag image URLs and emoji.
+	DrivingSide       bool            `json:"drivingSide"`       // "left" or "right".
+	PopulationDensity bool            `json:"populationDensity"` // People per square kilometre.
+}
+
+// ForecastFeature selects a forecast series; it is disabled while Days is 0.
+type ForecastFeature struct {
+	Days       int    `json:"days"`       // 1 to 16 days, starting today.
+	Resolution string `json:"resolution"` // "daily" (default) or "hourly".
 }
 
 type DashboardConfig struct {
-	ID         string   `json:"id"`
-	Country    string   `json:"country"`  // Full country name.
-	ISOCode    string   `json:"isoCode"`  // Two-letter country code.
-	Currency   string   `json:"currency"` // Three-letter currency code.
-	Features   Features `json:"features"`
-	LastChange string   `json:"lastChange"`
+	ID          string     `json:"id"`
+	Country     string     `json:"country"`               // Full country name.
+	ISOCode     string     `json:"isoCode"`               // Two-letter country code.
+	ISOCode3    string     `json:"isoCode3,omitempty"`    // Three-letter country code.
+	NumericCode string     `json:"numericCode,omitempty"` // Three-digit country code.
+	Currency    string     `json:"currency"`              // Primary three-letter currency code; the client may override it.
+	Currencies  []string   `json:"currencies"`            // Every currency the country uses, primary one first.
+	Features    Features   `json:"features"`
+	LastChange  string     `json:"lastChange"`
+	Owner       string     `json:"owner"`               // ID of the API key that created the registration.
+	Location    *Location  `json:"location,omitempty"`  // Where the weather is taken; the capital when unset.
+	Locations   []Location `json:"locations,omitempty"` // Further places in the country to show the weather for.
+	Display     *Display   `json:"display,omitempty"`   // How the dashboard is rendered; metric and RFC 3339 in UTC when unset.
+}
+
+// Display sets the units and formatting a dashboard and its webhook payloads are rendered with.
+type Display struct {
+	Units      string `json:"units,omitempty"`      // "metric" (default) or "imperial".
+	TimeFormat string `json:"timeFormat,omitempty"` // "rfc3339" (default), "unix" or "legacy" (20060102 15:04).
+	Timezone   string `json:"timezone,omitempty"`   // IANA timezone of timestamps, e.g. "Europe/Oslo"; UTC by default.
+	Decimals   *int   `json:"decimals,omitempty"`   // Rounds numbers in features to this many decimals, 0 to 10.
+}
+
+// Location pins the dashboard weather to a city, or to coordinates, inside the country.
+type Location struct {
+	Name      string   `json:"name,omitempty"` // Label shown on the dashboard; defaults to the city.
+	City      string   `json:"city,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// Comparison shows the same features for several registrations or countries side by side.
+type Comparison struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Registrations []string `json:"registrations,omitempty"` // IDs of dashboard registrations.
+	ISOCodes      []string `json:"isoCodes,omitempty"`      // Countries without a registration.
+	Features      Features `json:"features"`
+	BaseCurrency  string   `json:"baseCurrency,omitempty"` // Ranks the countries' currencies against this one.
+	LastChange    string   `json:"lastChange"`
+	Owner         string   `json:"owner"` // ID of the API key that created the comparison.
 }
 
 type Webhook struct {
@@ -29,36 +90,81 @@ type Webhook struct {
 	URL     string `firebase:"url" json:"url"`
 	Country string `firebase:"country" json:"country"`
 	Event   string `firebase:"event" json:"event"`
+	Owner   string `firebase:"owner" json:"owner"` // ID of the API key that created the webhook.
+}
+
+// APIKey is a client credential. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Hash    string `json:"hash"`
+	Created string `json:"created"`
+	Role    Role   `json:"role"`
+	Owner   string `json:"owner,omitempty"` // Key whose resources this key works on; empty means its own.
+}
+
+// cacheData is the part of the cache that is persisted to cacheFile.
+type cacheData struct {
+	Configs     map[string]DashboardConfig `json:"configs"`
+	Webhooks    map[string]Webhook         `json:"webhooks"`
+	Keys        map[string]APIKey          `json:"keys"`
+	Comparisons map[string]Comparison      `json:"comparisons"`
+	RateHistory map[string]dailyRates      `json:"rateHistory"` // Observed exchange rates by base currency.
 }
 
 type Cache struct {
-	Configs  map[string]DashboardConfig `json:"configs"`
-	Webhooks map[string]Webhook         `json:"webhooks"`
+	cacheData
 	sync.RWMutex
 }
 
-var appCache = Cache{
-	Configs:  make(map[string]DashboardConfig),
-	Webhooks: make(map[string]Webhook),
-}
+var appCache = Cache{cacheData: cacheData{
+	Configs:     make(map[string]DashboardConfig),
+	Webhooks:    make(map[string]Webhook),
+	Keys:        make(map[string]APIKey),
+	Comparisons: make(map[string]Comparison),
+	RateHistory: make(map[string]dailyRates),
+}}
 
 var startTime = time.Now()
 
 const cacheFile = "stored-data/cache.json"
 
 type FeaturesUpdate struct {
-	Temperature      *bool     `json:"temperature,omitempty"`
-	Precipitation    *bool     `json:"precipitation,omitempty"`
-	Capital          *bool     `json:"capital,omitempty"`
-	Coordinates      *bool     `json:"coordinates,omitempty"`
-	Population       *bool     `json:"population,omitempty"`
-	Area             *bool     `json:"area,omitempty"`
-	TargetCurrencies *[]string `json:"targetCurrencies,omitempty"`
+	Temperature       *bool            `json:"temperature,omitempty"`
+	Precipitation     *bool            `json:"precipitation,omitempty"`
+	Capital           *bool            `json:"capital,omitempty"`
+	Coordinates       *bool            `json:"coordinates,omitempty"`
+	Population        *bool            `json:"population,omitempty"`
+	Area              *bool            `json:"area,omitempty"`
+	TargetCurrencies  *[]string        `json:"targetCurrencies,omitempty"`
+	Current           *bool            `json:"current,omitempty"`
+	Today             *bool            `json:"today,omitempty"`
+	Forecast          *ForecastFeature `json:"forecast,omitempty"`
+	Wind              *bool            `json:"wind,omitempty"`
+	Humidity          *bool            `json:"humidity,omitempty"`
+	CloudCover        *bool            `json:"cloudCover,omitempty"`
+	UVIndex           *bool            `json:"uvIndex,omitempty"`
+	Sun               *bool            `json:"sun,omitempty"`
+	AirQuality        *bool            `json:"airQuality,omitempty"`
+	CurrencyHistory   *int             `json:"currencyHistory,omitempty"`
+	CurrencyChange    *bool            `json:"currencyChange,omitempty"`
+	AllCurrencies     *bool            `json:"allCurrencies,omitempty"`
+	Languages         *bool            `json:"languages,omitempty"`
+	Borders           *bool            `json:"borders,omitempty"`
+	Region            *bool            `json:"region,omitempty"`
+	Timezones         *bool            `json:"timezones,omitempty"`
+	CallingCodes      *bool            `json:"callingCodes,omitempty"`
+	Flag              *bool            `json:"flag,omitempty"`
+	DrivingSide       *bool            `json:"drivingSide,omitempty"`
+	PopulationDensity *bool            `json:"populationDensity,omitempty"`
 }
 
 type DashboardConfigUpdate struct {
-	Country  *string         `json:"country,omitempty"`
-	ISOCode  *string         `json:"isoCode,omitempty"`
-	Currency *string         `json:"currency,omitempty"`
-	Features *FeaturesUpdate `json:"features,omitempty"`
+	Country   *string         `json:"country,omitempty"`
+	ISOCode   *string         `json:"isoCode,omitempty"`
+	Currency  *string         `json:"currency,omitempty"`
+	Features  *FeaturesUpdate `json:"features,omitempty"`
+	Location  *Location       `json:"location,omitempty"` // An empty location goes back to the capital.
+	Locations *[]Location     `json:"locations,omitempty"`
+	Display   *Display        `json:"display,omitempty"` // Replaces the display settings; an empty one resets them.
 }
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --------------------------
+// Currency Conversion
+// --------------------------
+
+// errUnknownCurrency is returned by fetchCurrencyRates when the currency API does not know the base currency.
+var errUnknownCurrency = errors.New("unknown currency")
+
+// parseAmount reads an amount of money from a query parameter.
+func parseAmount(raw string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) || amount < 0 {
+		return 0, fmt.Errorf("amount must be a non-negative number")
+	}
+	return amount, nil
+}
+
+// HandleConvert converts an amount between currencies with the rates the dashboards use, e.g.
+// /dashboard/v1/convert?from=NOK&to=EUR,USD&amount=100. Unknown target currencies are listed
+// under "unknown" rather than failing the request.
+func HandleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requirePermission(w, r, permViewDashboards) {
+		return
+	}
+	query := r.URL.Query()
+	from := strings.ToUpper(strings.TrimSpace(query.Get("from")))
+	if !isCurrencyCode(from) {
+		http.Error(w, "from must be a three-letter currency code", http.StatusBadRequest)
+		return
+	}
+	var targets []string
+	for _, code := range strings.Split(query.Get("to"), ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			targets = append(targets, code)
+		}
+	}
+	if len(targets) == 0 {
+		http.Error(w, "to must list at least one currency code", http.StatusBadRequest)
+		return
+	}
+	amount := 1.0
+	if raw := query.Get("amount"); raw != "" {
+		var err error
+		if amount, err = parseAmount(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	fetched, err := fetchCurrencyRates(r.Context(), from)
+	if errors.Is(err, errUnknownCurrency) {
+		http.Error(w, "Unknown currency "+from, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "error fetching currency rates", "base", from, "error", err)
+	}
+	rates, status, ok := lastRates.resolve(from, fetched, err)
+	if !ok {
+		http.Error(w, "Exchange rates unavailable: "+status.Error, http.StatusBadGateway)
+		return
+	}
+
+	converted := map[string]float64{}
+	used := map[string]float64{}
+	unknown := []string{}
+	for _, code := range targets {
+		rate, found := rates[code]
+		if code == from {
+			rate, found = 1, true
+		}
+		if !found {
+			unknown = append(unknown, code)
+			continue
+		}
+		converted[code] = amount * rate
+		used[code] = rate
+	}
+	result := map[string]interface{}{
+		"from":        from,
+		"amount":      amount,
+		"conversions": converted,
+		"rates":       used,
+		"source":      status,
+	}
+	if len(unknown) > 0 {
+		result["unknown"] = unknown
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
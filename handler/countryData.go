@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// --------------------------
+// Offline Country Dataset
+// --------------------------
+
+// countryDataset is a copy of the country data in the layout of the countries API, regenerated
+// with cmd/countrydata. The copy that ships comes from mledoze/countries (ODbL, see data/NOTICE).
+//
+//go:embed data/countries.json
+var countryDataset []byte
+
+// Values of COUNTRY_DATA.
+const (
+	countryDataFallback = "fallback" // The countries API first, the dataset when it fails.
+	countryDataPrimary  = "primary"  // Only the dataset; the countries API is not called.
+	countryDataOff      = "off"      // Only the countries API.
+)
+
+// countryDataMode reads COUNTRY_DATA from the environment, defaulting to fallback.
+func countryDataMode() string {
+	switch mode := strings.ToLower(strings.TrimSpace(envOr("COUNTRY_DATA", countryDataFallback))); mode {
+	case countryDataPrimary, countryDataOff:
+		return mode
+	}
+	return countryDataFallback
+}
+
+// offlineFields are the fields of a dataset record that dashboard features are taken from.
+var offlineFields = []string{
+	"capital", "capitalInfo", "latlng", "population", "area", "languages", "borders", "region",
+	"subregion", "timezones", "idd", "flags", "car",
+}
+
+// offlineRecord is one country of the dataset, with the offlineFields its record has no value
+// for. The copy that ships was not made from a countries API dump, so it lacks fields the API
+// has, such as population.
+type offlineRecord struct {
+	restCountry
+	missing []string
+}
+
+var offlineCountries = sync.OnceValues(func() ([]offlineRecord, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(countryDataset, &raw); err != nil {
+		return nil, fmt.Errorf("error decoding offline country dataset: %w", err)
+	}
+	countries := make([]offlineRecord, len(raw))
+	if err := json.Unmarshal(countryDataset, &countries); err != nil {
+		return nil, fmt.Errorf("error decoding offline country dataset: %w", err)
+	}
+	for i, fields := range raw {
+		for _, field := range offlineFields {
+			if _, ok := fields[field]; !ok {
+				countries[i].missing = append(countries[i].missing, field)
+			}
+		}
+	}
+	return countries, nil
+})
+
+// offlineCountry looks a country up in the dataset the way the countries API would: by any of
+// its codes, or by its full common or official name.
+func offlineCountry(query string) (countryInfo, error) {
+	countries, err := offlineCountries()
+	if err != nil {
+		return countryInfo{}, err
+	}
+	trimmed := strings.TrimSpace(query)
+	code, isCode := countryCode(trimmed)
+	for _, res := range countries {
+		var match bool
+		if isCode {
+			match = strings.EqualFold(code, res.Cca2) || strings.EqualFold(code, res.Cca3) || code == res.Ccn3
+		} else {
+			match = strings.EqualFold(trimmed, res.Name.Common) || strings.EqualFold(trimmed, res.Name.Official)
+		}
+		if match {
+			country := res.info()
+			country.Offline = true
+			country.Missing = res.missing
+			return country, nil
+		}
+	}
+	return countryInfo{}, fmt.Errorf("%w: %q", errCountryNotFound, trimmed)
+}
+
+// offlineIndex is the search index of the dataset.
+func offlineIndex() ([]countryEntry, error) {
+	countries, err := offlineCountries()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]countryEntry, len(countries))
+	for i, res := range countries {
+		entries[i] = res.entry()
+	}
+	return entries, nil
+}
+
+// offlineNames looks up the common names of countries by their three-letter codes in the dataset.
+func offlineNames(codes []string) (map[string]string, error) {
+	countries, err := offlineCountries()
+	if err != nil {
+		return nil, err
+	}
+	wanted := map[string]bool{}
+	for _, code := range codes {
+		wanted[strings.ToUpper(code)] = true
+	}
+	names := map[string]string{}
+	for _, res := range countries {
+		if code := strings.ToUpper(res.Cca3); wanted[code] {
+			names[code] = res.Name.Common
+		}
+	}
+	return names, nil
+}
+
+// resolveCountry fetches a country for a dashboard. When the countries API fails, the last known
+// good value is served, and failing that the offline dataset.
+func resolveCountry(ctx context.Context, query string) (countryInfo, sourceStatus, bool) {
+	fetched, err := fetchCountry(ctx, query)
+	if err != nil {
+		slog.WarnContext(ctx, "error fetching country details", "country", query, "error", err)
+	}
+	country, status, ok := lastCountries.resolve(strings.ToLower(query), fetched, err)
+	if !ok && !errors.Is(err, errCountryNotFound) && countryDataMode() == countryDataFallback {
+		if offline, offlineErr := offlineCountry(query); offlineErr == nil {
+			country, ok = offline, true
+		}
+	}
+	status.Offline = ok && country.Offline
+	return country, status, ok
+}
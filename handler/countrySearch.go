@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"assignment_02/api"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------
+// Country Search
+// --------------------------
+
+// errCountryNotFound is returned by fetchCountry when the countries API has no exact match.
+var errCountryNotFound = errors.New("country not found")
+
+// countryIndexTTL is how long the list of all countries is used before it is fetched again.
+const countryIndexTTL = 24 * time.Hour
+
+// maxSearchResults caps the limit parameter of a country search.
+const maxSearchResults = 50
+
+// countryEntry is one country of the search index, with every name it can be found by.
+type countryEntry struct {
+	Name     string
+	Official string
+	Cca2     string
+	Cca3     string
+	Native   []string // Common and official names in the country's own languages.
+	Alt      []string // Alternative spellings, including short forms such as "UK".
+}
+
+// countryMatch is one search result.
+type countryMatch struct {
+	Name         string `json:"name"`
+	OfficialName string `json:"officialName"`
+	ISOCode      string `json:"isoCode"`
+	Cca3         string `json:"cca3"`
+	Matched      string `json:"matched"` // The name or code the query matched.
+	Score        int    `json:"score"`
+}
+
+var countryIndex struct {
+	sync.Mutex
+	entries []countryEntry
+	fetched time.Time
+}
+
+// loadCountryIndex returns every country, fetching the list when it is older than
+// countryIndexTTL. When fetching fails, an old list is kept in use, or the offline dataset
+// is searched instead.
+func loadCountryIndex(ctx context.Context) ([]countryEntry, error) {
+	mode := countryDataMode()
+	if mode == countryDataPrimary {
+		return offlineIndex()
+	}
+	countryIndex.Lock()
+	defer countryIndex.Unlock()
+	fresh := countryIndex.entries != nil && time.Since(countryIndex.fetched) < countryIndexTTL
+	recordCacheLookup("country_index", fresh)
+	if fresh {
+		return countryIndex.entries, nil
+	}
+	entries, err := fetchCountryIndex(ctx)
+	if err != nil {
+		if countryIndex.entries != nil {
+			slog.WarnContext(ctx, "serving old country index", "error", err)
+			return countryIndex.entries, nil
+		}
+		if mode == countryDataFallback {
+			slog.WarnContext(ctx, "searching offline country dataset", "error", err)
+			return offlineIndex()
+		}
+		return nil, err
+	}
+	countryIndex.entries, countryIndex.fetched = entries, time.Now()
+	return entries, nil
+}
+
+func fetchCountryIndex(ctx context.Context) ([]countryEntry, error) {
+	resp, err := upstreamGet(ctx, "countries", api.CountriesIndex)
+	if err != nil {
+		return nil, fmt.Errorf("error calling countries API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("countries API returned status %d", resp.StatusCode)
+	}
+	var results []restCountry
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("error decoding countries API response: %w", err)
+	}
+	entries := make([]countryEntry, len(results))
+	for i, res := range results {
+		entries[i] = res.entry()
+	}
+	return entries, nil
+}
+
+// entry converts res to a search index entry.
+func (res restCountry) entry() countryEntry {
+	entry := countryEntry{
+		Name:     res.Name.Common,
+		Official: res.Name.Official,
+		Cca2:     strings.ToUpper(res.Cca2),
+		Cca3:     strings.ToUpper(res.Cca3),
+		Alt:      res.AltSpellings,
+	}
+	for _, native := range res.Name.NativeName {
+		entry.Native = append(entry.Native, native.Common, native.Official)
+	}
+	sort.Strings(entry.Native)
+	return entry
+}
+
+// searchCountries ranks the countries matching query, best first, and returns at most limit.
+func searchCountries(ctx context.Context, query string, limit int) ([]countryMatch, error) {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return []countryMatch{}, nil
+	}
+	entries, err := loadCountryIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches := []countryMatch{}
+	for _, entry := range entries {
+		if score, matched := scoreCountry(entry, q); score > 0 {
+			matches = append(matches, countryMatch{
+				Name:         entry.Name,
+				OfficialName: entry.Official,
+				ISOCode:      entry.Cca2,
+				Cca3:         entry.Cca3,
+				Matched:      matched,
+				Score:        score,
+			})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// scoreCountry scores how well the lowercase query q matches entry and returns the name or code
+// that matched best. Codes only match exactly. Names score by how they match: exactly, at the
+// start, at the start of a word, anywhere, or within a couple of typos. The common name beats
+// the official name, which beats native names and alternative spellings. 0 means no match.
+func scoreCountry(entry countryEntry, q string) (int, string) {
+	if q == strings.ToLower(entry.Cca2) || q == strings.ToLower(entry.Cca3) {
+		if len(q) == 2 {
+			return 100, entry.Cca2
+		}
+		return 100, entry.Cca3
+	}
+	best, matched := 0, ""
+	try := func(name string, bonus int) {
+		if name == "" {
+			return
+		}
+		if score := scoreName(strings.ToLower(name), q); score > 0 && score+bonus > best {
+			best, matched = score+bonus, name
+		}
+	}
+	try(entry.Name, 4)
+	try(entry.Official, 2)
+	for _, name := range entry.Native {
+		try(name, 0)
+	}
+	for _, name := range entry.Alt {
+		try(name, 0)
+	}
+	return best, matched
+}
+
+func scoreName(name, q string) int {
+	switch {
+	case name == q:
+		return 90
+	case strings.HasPrefix(name, q):
+		return 70
+	case strings.Contains(" "+name, " "+q):
+		return 60
+	case strings.Contains(name, q):
+		return 50
+	}
+	// Allow one typo for every four letters, but none in very short queries.
+	allowed := len([]rune(q)) / 4
+	if allowed == 0 {
+		return 0
+	}
+	if d := editDistance(name, q); d <= allowed {
+		return 40 - 5*d
+	}
+	return 0
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// A search match resolves a lookup on its own when it matches a name from the start, or better,
+// and no other country matches as well. A weaker match has to match at the start of a word and
+// beat the next by searchMargin; matches inside a word or with typos never resolve a lookup.
+const (
+	minSearchScore = 70
+	minWinnerScore = 60
+	searchMargin   = 10
+)
+
+// bestMatch picks the country a lookup resolves to out of the search matches, best first, and
+// reports false when none is good enough to be sure of.
+func bestMatch(matches []countryMatch) (countryMatch, bool) {
+	if len(matches) == 0 {
+		return countryMatch{}, false
+	}
+	top, next := matches[0], 0
+	if len(matches) > 1 {
+		next = matches[1].Score
+	}
+	return top, top.Score >= minSearchScore && top.Score > next || top.Score >= minWinnerScore && top.Score-next >= searchMargin
+}
+
+// lookupCountry finds a country by exact name or code, using the offline dataset when the
+// countries API fails. When there is no exact match it falls back to the best search match,
+// so "UK", "Britain" or "Norge" resolve too, as long as that match is clear.
+func lookupCountry(ctx context.Context, query string) (countryInfo, error) {
+	exact := func(query string) (countryInfo, error) {
+		country, err := fetchCountry(ctx, query)
+		if err != nil && !errors.Is(err, errCountryNotFound) && countryDataMode() == countryDataFallback {
+			slog.WarnContext(ctx, "looking up country in offline dataset", "country", query, "error", err)
+			return offlineCountry(query)
+		}
+		return country, err
+	}
+	country, err := exact(query)
+	if !errors.Is(err, errCountryNotFound) {
+		return country, err
+	}
+	matches, searchErr := searchCountries(ctx, query, 2)
+	match, ok := bestMatch(matches)
+	if searchErr != nil || !ok {
+		if len(matches) > 0 {
+			slog.DebugContext(ctx, "country search not conclusive", "query", query, "best", matches[0].Name, "score", matches[0].Score)
+		}
+		return country, err
+	}
+	slog.DebugContext(ctx, "country resolved by search", "query", query, "country", match.Name, "matched", match.Matched)
+	return exact(match.ISOCode)
+}
+
+// HandleCountrySearch serves /dashboard/v1/countries?q=nor&limit=10, for autocomplete and
+// for finding the name or code to register a country with.
+func HandleCountrySearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requirePermission(w, r, permViewDashboards) {
+		return
+	}
+	query := r.URL.Query()
+	if strings.TrimSpace(query.Get("q")) == "" {
+		http.Error(w, "q must not be empty", http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchResults {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxSearchResults), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	matches, err := searchCountries(r.Context(), query.Get("q"), limit)
+	if err != nil {
+		slog.WarnContext(r.Context(), "country search failed", "error", err)
+		http.Error(w, "Country search is unavailable", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------
+// Batch Dashboards
+// --------------------------
+
+// maxBatchDashboards caps the registrations populated by one batch request.
+const maxBatchDashboards = 100
+
+// batchWorkers reads BATCH_WORKERS, the number of dashboards a batch populates at once
+// (default 4).
+func batchWorkers() int {
+	n, err := strconv.Atoi(envOr("BATCH_WORKERS", "4"))
+	if err != nil || n <= 0 {
+		return 4
+	}
+	return n
+}
+
+// batchRequest is the body of a batch request. Registrations is a list of registration IDs, or
+// "all" for every registration the caller can see. With "all", After is the next field of the
+// previous page, so batches larger than maxBatchDashboards are fetched a page at a time.
+type batchRequest struct {
+	Registrations json.RawMessage `json:"registrations"`
+	After         string          `json:"after,omitempty"`
+}
+
+// batchUnsupported are the dashboard query parameters a batch does not take.
+var batchUnsupported = []string{"format", "fields", "amount"}
+
+// HandleDashboardBatch serves POST /dashboard/v1/dashboards/batch, which populates several
+// dashboards in one request. Upstream lookups the dashboards have in common, such as a country
+// shared by two registrations or the rates of a currency, are made once for the whole batch.
+// Every dashboard counts against the daily quota, as when fetched one at a time.
+func HandleDashboardBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requirePermission(w, r, permViewDashboards) {
+		return
+	}
+	for _, param := range batchUnsupported {
+		if r.URL.Query().Has(param) {
+			http.Error(w, param+"= is not supported for batches", http.StatusBadRequest)
+			return
+		}
+	}
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	ids, next, err := batchIDs(r.Context(), req.Registrations, req.After)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	appCache.RLock()
+	configs := make([]DashboardConfig, len(ids))
+	missing := map[int]bool{}
+	for i, id := range ids {
+		config, exists := appCache.Configs[id]
+		if !exists || !canAccess(r.Context(), config.Owner) {
+			missing[i] = true
+		}
+		configs[i] = config
+	}
+	appCache.RUnlock()
+
+	// Display settings given as query parameters apply to every dashboard of the batch.
+	displays := make([]Display, len(configs))
+	for i, config := range configs {
+		if missing[i] {
+			continue
+		}
+		if displays[i], err = displayFor(config.Display, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The request itself was counted by RateLimit; the other dashboards are counted here.
+	if populated := len(configs) - len(missing); populated > 1 {
+		now, limit := time.Now(), QuotaLimit()
+		if !dailyQuota.take(clientID(r), populated-1, limit, now) {
+			w.Header().Set("Retry-After", seconds(untilMidnightUTC(now)))
+			slog.WarnContext(r.Context(), "daily quota exceeded by batch", "client", clientID(r), "dashboards", populated)
+			http.Error(w, fmt.Sprintf("A batch of %d dashboards would exceed the daily quota of %d requests", populated, limit), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	ctx := withUpstreamMemo(r.Context())
+	dashboards := make([]interface{}, len(configs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(batchWorkers(), len(configs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				populated, _ := populateDashboard(ctx, configs[i], dashboardOptions{Display: displays[i]})
+				populated.Registration = ids[i]
+				dashboards[i] = populated
+			}
+		}()
+	}
+	for i := range configs {
+		if missing[i] {
+			dashboards[i] = map[string]interface{}{"registration": ids[i], "error": "registration not found"}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	slog.InfoContext(r.Context(), "dashboard batch populated", "dashboards", len(ids), "missing", len(missing))
+
+	result := map[string]interface{}{"dashboards": dashboards}
+	if next != "" {
+		result["next"] = next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+
+	// Trigger INVOKE webhook notifications, as for dashboards fetched one at a time, but no more
+	// deliveries at once than dashboards were populated at once.
+	var deliveries []webhookDelivery
+	for i, config := range configs {
+		if !missing[i] {
+			deliveries = append(deliveries, webhookDeliveries(r.Context(), config.Owner, "INVOKE", config.ISOCode, displayOf(config.Display))...)
+		}
+	}
+	go sendWebhookNotifications(r.Context(), deliveries, batchWorkers())
+}
+
+// batchIDs parses the registrations of a batch request: a list of IDs, without duplicates, or
+// "all" for the IDs of every registration visible to the caller, in order, starting after the
+// ID after. A list longer than maxBatchDashboards is refused, while "all" is cut to the first
+// maxBatchDashboards IDs and next is set to the last of them for the following page.
+func batchIDs(ctx context.Context, raw json.RawMessage, after string) (ids []string, next string, err error) {
+	var all string
+	if err := json.Unmarshal(raw, &all); err == nil {
+		if !strings.EqualFold(all, "all") {
+			return nil, "", fmt.Errorf(`registrations must be a list of IDs or "all"`)
+		}
+		appCache.RLock()
+		for id, config := range appCache.Configs {
+			if id > after && canAccess(ctx, config.Owner) {
+				ids = append(ids, id)
+			}
+		}
+		appCache.RUnlock()
+		sort.Strings(ids)
+		if len(ids) > maxBatchDashboards {
+			ids = ids[:maxBatchDashboards]
+			next = ids[len(ids)-1]
+		}
+		return ids, next, nil
+	}
+	if after != "" {
+		return nil, "", fmt.Errorf(`after only applies to "all"`)
+	}
+	var listed []string
+	if err := json.Unmarshal(raw, &listed); err != nil {
+		return nil, "", fmt.Errorf(`registrations must be a list of IDs or "all"`)
+	}
+	seen := map[string]bool{}
+	for _, id := range listed {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, "", fmt.Errorf("registrations must list at least one ID")
+	}
+	if len(ids) > maxBatchDashboards {
+		return nil, "", fmt.Errorf("a batch can populate at most %d dashboards, got %d", maxBatchDashboards, len(ids))
+	}
+	return ids, "", nil
+}
@@ -0,0 +1,387 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --------------------------
+// Output Formats
+// --------------------------
+
+// Formats dashboards and registrations can be rendered in.
+const (
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatXML      = "xml"
+	formatMarkdown = "markdown"
+)
+
+// formatTypes are the content types of each format, the one served first.
+var formatTypes = map[string][]string{
+	formatJSON:     {"application/json"},
+	formatCSV:      {"text/csv"},
+	formatXML:      {"application/xml", "text/xml"},
+	formatMarkdown: {"text/markdown"},
+}
+
+// negotiateFormat picks the format of a response: format= when given, else JSON, unless another
+// format we serve is the client's first choice and rated above both JSON and */*. Browsers list
+// XML after HTML, and clients asking for a type we don't serve, still get JSON.
+func negotiateFormat(r *http.Request) (string, error) {
+	if raw := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); raw != "" {
+		if raw == "md" {
+			raw = formatMarkdown
+		}
+		if _, ok := formatTypes[raw]; !ok {
+			return "", fmt.Errorf("format must be json, csv, xml or markdown")
+		}
+		return raw, nil
+	}
+	// quality is the highest quality the header gives each format, with */* counting for JSON;
+	// top is the highest it gives any type, served or not.
+	quality := map[string]float64{}
+	var listed []string
+	top := 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+		top = max(top, q)
+		var format string
+		switch mediaType {
+		case "*/*", "application/*", "application/json":
+			format = formatJSON
+		case "text/csv":
+			format = formatCSV
+		case "application/xml", "text/xml":
+			format = formatXML
+		case "text/markdown":
+			format = formatMarkdown
+		default:
+			continue
+		}
+		if _, ok := quality[format]; !ok {
+			listed = append(listed, format)
+		}
+		quality[format] = max(quality[format], q)
+	}
+	best := formatJSON
+	for _, format := range listed {
+		if quality[format] > quality[best] && quality[format] == top {
+			best = format
+		}
+	}
+	return best, nil
+}
+
+// requestFormat negotiates the format of the response to r, writing an error when format= names
+// a format we don't serve. It returns false when the error has been written.
+func requestFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return format, true
+}
+
+// setFormatHeaders sets the Content-Type of format on a response.
+func setFormatHeaders(w http.ResponseWriter, format string) {
+	contentType := formatTypes[format][0]
+	if format != formatJSON {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+}
+
+// generic converts v to its JSON form as maps, slices, strings, float64s, bools and nils.
+func generic(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// flatten adds every scalar in v to into, keyed by its dotted path under prefix, e.g.
+// "features.wind.speed.value" or "features.languages.0".
+func flatten(prefix string, v interface{}, into map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			flatten(join(key), inner, into)
+		}
+	case []interface{}:
+		for i, inner := range v {
+			flatten(join(strconv.Itoa(i)), inner, into)
+		}
+	default:
+		into[prefix] = scalar(v)
+	}
+}
+
+// scalar renders a JSON scalar as text; null is empty.
+func scalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// renderDashboard writes a populated dashboard in format.
+func renderDashboard(w io.Writer, format string, d *dashboardResponse) error {
+	switch format {
+	case formatCSV:
+		// One field per row, so the columns are the same whatever features are enabled.
+		flat := map[string]string{}
+		flatten("", generic(d), flat)
+		out := csv.NewWriter(w)
+		out.Write([]string{"field", "value"})
+		for _, key := range sortedKeys(flat) {
+			out.Write([]string{key, flat[key]})
+		}
+		out.Flush()
+		return out.Error()
+	case formatXML:
+		return writeXML(w, "dashboard", generic(d))
+	case formatMarkdown:
+		return dashboardMarkdown(w, d)
+	}
+	return json.NewEncoder(w).Encode(d)
+}
+
+// renderRegistrations writes a list of registrations in format.
+func renderRegistrations(w io.Writer, format string, configs []DashboardConfig) error {
+	switch format {
+	case formatCSV:
+		// One registration per row, with a column for every field any of them has.
+		rows := make([]map[string]string, len(configs))
+		columns := map[string]string{}
+		for i, config := range configs {
+			rows[i] = map[string]string{}
+			flatten("", generic(config), rows[i])
+			for key := range rows[i] {
+				columns[key] = ""
+			}
+		}
+		delete(columns, "id")
+		header := append([]string{"id"}, sortedKeys(columns)...)
+		out := csv.NewWriter(w)
+		out.Write(header)
+		for _, row := range rows {
+			record := make([]string, len(header))
+			for i, key := range header {
+				record[i] = row[key]
+			}
+			out.Write(record)
+		}
+		out.Flush()
+		return out.Error()
+	case formatXML:
+		items := make([]interface{}, len(configs))
+		for i, config := range configs {
+			items[i] = generic(config)
+		}
+		return writeXML(w, "registrations", items)
+	case formatMarkdown:
+		return registrationsMarkdown(w, configs)
+	}
+	return json.NewEncoder(w).Encode(configs)
+}
+
+// writeXML writes v, in its JSON form, as an XML document with the given root element. Object
+// keys become elements, or entry elements with a key attribute when they are no valid XML
+// name, and array elements become item elements.
+func writeXML(w io.Writer, root string, v interface{}) error {
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	var write func(name string, v interface{}) error
+	write = func(name string, v interface{}) error {
+		start := xml.StartElement{Name: xml.Name{Local: name}}
+		if !xmlName(name) {
+			start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+		}
+		if v == nil {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "null"}, Value: "true"})
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				if err := write(key, v[key]); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			item := "item"
+			if name == "registrations" {
+				item = "registration"
+			}
+			for _, inner := range v {
+				if err := write(item, inner); err != nil {
+					return err
+				}
+			}
+		case nil:
+		default:
+			if err := enc.EncodeToken(xml.CharData(scalar(v))); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	}
+	if err := write(root, v); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// xmlName reports whether name can be used as an element name as is.
+func xmlName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || !(c == '-' || c == '.' || (c >= '0' && c <= '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// markdownCell escapes a value for a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// dashboardMarkdown writes a dashboard as a Markdown summary: a table of features, followed by
+// what was unavailable and which sources were stale or offline.
+func dashboardMarkdown(w io.Writer, d *dashboardResponse) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s (%s)\n\n", d.Country, d.ISOCode)
+	if d.Amount != nil {
+		fmt.Fprintf(&b, "Amounts for %s %s.\n\n", strconv.FormatFloat(d.Amount.Value, 'f', -1, 64), d.Amount.Currency)
+	}
+	features := map[string]string{}
+	flatten("", generic(d.Features), features)
+	b.WriteString("| Feature | Value |\n| --- | --- |\n")
+	for _, key := range sortedKeys(features) {
+		fmt.Fprintf(&b, "| %s | %s |\n", markdownCell(key), markdownCell(features[key]))
+	}
+	for i, loc := range d.Locations {
+		flat := map[string]string{}
+		flatten("", generic(loc["features"]), flat)
+		fmt.Fprintf(&b, "\n## %s\n\n| Feature | Value |\n| --- | --- |\n", markdownCell(scalar(generic(loc["name"]))))
+		if len(flat) == 0 {
+			fmt.Fprintf(&b, "| (none) | location %d has no features |\n", i+1)
+		}
+		for _, key := range sortedKeys(flat) {
+			fmt.Fprintf(&b, "| %s | %s |\n", markdownCell(key), markdownCell(flat[key]))
+		}
+	}
+	if len(d.Unavailable) > 0 {
+		b.WriteString("\n## Unavailable\n\n")
+		for _, key := range sortedKeys(d.Unavailable) {
+			fmt.Fprintf(&b, "- **%s**: %s\n", key, d.Unavailable[key])
+		}
+	}
+	var notes []string
+	for name, status := range d.Sources {
+		switch {
+		case status.Offline:
+			notes = append(notes, fmt.Sprintf("- **%s** from the offline dataset", name))
+		case status.Stale:
+			notes = append(notes, fmt.Sprintf("- **%s** is %d seconds old: %s", name, status.Age, status.Error))
+		}
+	}
+	if len(notes) > 0 {
+		sort.Strings(notes)
+		b.WriteString("\n## Sources\n\n" + strings.Join(notes, "\n") + "\n")
+	}
+	fmt.Fprintf(&b, "\n_Units: %s. Retrieved %s._\n", d.Units, d.LastRetrieval)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// registrationsMarkdown writes registrations as a Markdown table with their enabled features.
+func registrationsMarkdown(w io.Writer, configs []DashboardConfig) error {
+	var b strings.Builder
+	b.WriteString("| ID | Country | ISO code | Currency | Features | Last change |\n| --- | --- | --- | --- | --- | --- |\n")
+	for _, config := range configs {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", markdownCell(config.ID), markdownCell(config.Country),
+			markdownCell(config.ISOCode), markdownCell(config.Currency), markdownCell(strings.Join(enabledFeatures(config.Features), ", ")),
+			markdownCell(config.LastChange))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// enabledFeatures lists the names of the features that are turned on.
+func enabledFeatures(f Features) []string {
+	var names []string
+	for name, value := range generic(f).(map[string]interface{}) {
+		switch value := value.(type) {
+		case bool:
+			if value {
+				names = append(names, name)
+			}
+		case float64:
+			if value > 0 {
+				names = append(names, name)
+			}
+		case []interface{}:
+			if len(value) > 0 {
+				names = append(names, name)
+			}
+		case map[string]interface{}:
+			if days, _ := value["days"].(float64); days > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,14 +1,21 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
 
 func RegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePermission(w, r, permManageRegistrations) {
+		return
+	}
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) > 4 && pathParts[4] != "" {
 		switch r.Method {
@@ -39,62 +46,134 @@ func handleCreateRegistration(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if strings.TrimSpace(config.Country) == "" && strings.TrimSpace(config.ISOCode) != "" {
-		name, _, _, _, iso, currency, _, _, err := fetchCountryDetails(config.ISOCode)
-		if err == nil && name != "" {
-			config.Country = name
-			config.ISOCode = strings.ToUpper(iso)
+	if err := validateFeatures(config.Features); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateLocation(config.Location); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateLocations(config.Locations); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if config.Display != nil {
+		if err := config.Display.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		if err == nil && currency != "" {
-			config.Currency = strings.ToUpper(currency)
+	}
+	config.Owner = principal(r.Context())
+	// A currency given by the client overrides the primary currency of the country.
+	override := strings.ToUpper(strings.TrimSpace(config.Currency))
+	if override != "" && !isCurrencyCode(override) {
+		http.Error(w, "currency must be a three-letter code", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(config.Country) == "" && strings.TrimSpace(config.ISOCode) != "" {
+		if country, err := lookupCountry(r.Context(), config.ISOCode); err == nil {
+			applyCountry(&config, country)
 		}
 	}
 	if strings.TrimSpace(config.ISOCode) == "" && strings.TrimSpace(config.Country) != "" {
-		name, _, _, _, iso, currency, _, _, err := fetchCountryDetails(config.Country)
-		if err == nil && name != "" {
-			config.Country = name
-			config.ISOCode = strings.ToUpper(iso)
-		}
-		if err == nil && currency != "" {
-			config.Currency = strings.ToUpper(currency)
+		if country, err := lookupCountry(r.Context(), config.Country); err == nil {
+			applyCountry(&config, country)
 		}
 	}
 	if strings.TrimSpace(config.ISOCode) != "" && strings.TrimSpace(config.Country) != "" {
-		name, _, _, _, iso, currency, _, _, err := fetchCountryDetails(config.Country)
-		if err == nil && name != "" {
-			config.Country = name
-			config.ISOCode = strings.ToUpper(iso)
-		}
-		if err == nil && currency != "" {
-			config.Currency = strings.ToUpper(currency)
+		if country, err := lookupCountry(r.Context(), config.Country); err == nil {
+			applyCountry(&config, country)
 		}
 	}
+	if override != "" {
+		config.Currency = override
+	}
 	config.ID = generateID()
 	config.LastChange = time.Now().Format("20060102 15:04")
 	appCache.Lock()
 	appCache.Configs[config.ID] = config
 	appCache.Unlock()
-	if err := saveCache(); err != nil {
-		log.Println("Error saving cache:", err)
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
 	}
 
 	// Trigger REGISTER webhook notifications.
-	sendWebhookNotification("REGISTER", config.ISOCode)
+	sendWebhookNotification(r.Context(), config.Owner, "REGISTER", config.ISOCode, displayOf(config.Display))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(config)
 }
 
+// applyCountry stores the canonical name, codes and currencies of a looked up country on config.
+func applyCountry(config *DashboardConfig, country countryInfo) {
+	config.Country = country.Name
+	config.ISOCode = strings.ToUpper(country.ISO)
+	config.ISOCode3 = strings.ToUpper(country.ISO3)
+	config.NumericCode = country.Numeric
+	if country.Currency != "" {
+		config.Currency = strings.ToUpper(country.Currency)
+		config.Currencies = country.Currencies
+	}
+}
+
+// currencyOverride is the currency a client chose over the primary currency of the country, or
+// "" when config uses the primary one.
+func currencyOverride(config DashboardConfig) string {
+	if len(config.Currencies) == 0 || config.Currency == config.Currencies[0] {
+		return ""
+	}
+	return config.Currency
+}
+
+// isCurrencyCode reports whether code is three letters, as currency codes are.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateFeatures rejects feature settings the dashboard cannot honour.
+func validateFeatures(f Features) error {
+	if f.Forecast.Days < 0 || f.Forecast.Days > maxForecastDays {
+		return fmt.Errorf("forecast days must be between 0 and %d", maxForecastDays)
+	}
+	switch f.Forecast.Resolution {
+	case "", "daily", "hourly":
+	default:
+		return fmt.Errorf("forecast resolution must be daily or hourly")
+	}
+	if f.CurrencyHistory < 0 || f.CurrencyHistory > rateHistoryDays {
+		return fmt.Errorf("currency history must be between 0 and %d days", rateHistoryDays)
+	}
+	return nil
+}
+
 func handleListRegistrations(w http.ResponseWriter, r *http.Request) {
 	appCache.RLock()
 	defer appCache.RUnlock()
+	format, ok := requestFormat(w, r)
+	if !ok {
+		return
+	}
 	var configs []DashboardConfig
 	for _, cfg := range appCache.Configs {
-		configs = append(configs, cfg)
+		if canAccess(r.Context(), cfg.Owner) {
+			configs = append(configs, cfg)
+		}
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ID < configs[j].ID })
+	setFormatHeaders(w, format)
+	if err := renderRegistrations(w, format, configs); err != nil {
+		slog.WarnContext(r.Context(), "error writing registrations", "format", format, "error", err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(configs)
 }
 
 func handleGetRegistration(w http.ResponseWriter, r *http.Request) {
@@ -108,7 +187,7 @@ func handleGetRegistration(w http.ResponseWriter, r *http.Request) {
 	appCache.RLock()
 	config, exists := appCache.Configs[id]
 	appCache.RUnlock()
-	if !exists {
+	if !exists || !canAccess(r.Context(), config.Owner) {
 		http.Error(w, "Configuration not found", http.StatusNotFound)
 		return
 	}
@@ -128,43 +207,65 @@ func handleUpdateRegistration(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	log.Printf("Update payload received for ID %s: %+v\n", id, updateData)
-	appCache.Lock()
+	if updateData.Currency != nil {
+		if code := strings.TrimSpace(*updateData.Currency); code != "" && !isCurrencyCode(code) {
+			http.Error(w, "currency must be a three-letter code", http.StatusBadRequest)
+			return
+		}
+	}
+	appCache.RLock()
 	existing, exists := appCache.Configs[id]
-	if !exists {
+	appCache.RUnlock()
+	if !exists || !canAccess(r.Context(), existing.Owner) {
+		http.Error(w, "Configuration not found", http.StatusNotFound)
+		return
+	}
+	// The country is looked up before the cache is locked, as a lookup can take several
+	// upstream calls and every request needs the cache.
+	var query string
+	if updateData.Country != nil {
+		query = strings.TrimSpace(*updateData.Country)
+	} else if updateData.ISOCode != nil {
+		query = strings.TrimSpace(*updateData.ISOCode)
+	}
+	var country countryInfo
+	var lookupErr error
+	if query != "" {
+		country, lookupErr = lookupCountry(r.Context(), query)
+	}
+
+	appCache.Lock()
+	existing, exists = appCache.Configs[id]
+	if !exists || !canAccess(r.Context(), existing.Owner) {
 		appCache.Unlock()
 		http.Error(w, "Configuration not found", http.StatusNotFound)
 		return
 	}
+	// A currency the client chose survives a change of country, unless the update sets one.
+	override := currencyOverride(existing)
 	if updateData.Country != nil {
-		if strings.TrimSpace(*updateData.Country) != "" {
-			name, _, _, _, iso, currency, _, _, err := fetchCountryDetails(*updateData.Country)
-			if err == nil {
-				existing.Country = name
-				existing.ISOCode = strings.ToUpper(iso)
-				existing.Currency = strings.ToUpper(currency)
-				log.Printf("Country updated via lookup: %s, ISO: %s, Currency: %s", name, iso, currency)
-			} else {
-				log.Printf("Warning: failed country lookup: %v", err)
-				existing.Country = *updateData.Country
-			}
-		} else {
+		if query == "" {
 			existing.Country = ""
+		} else if lookupErr == nil {
+			applyCountry(&existing, country)
+			slog.DebugContext(r.Context(), "country updated via lookup", "id", id, "country", country.Name, "iso", country.ISO, "currency", country.Currency)
+		} else {
+			slog.WarnContext(r.Context(), "failed country lookup", "id", id, "error", lookupErr)
+			existing.Country = *updateData.Country
 		}
-	} else if updateData.ISOCode != nil && strings.TrimSpace(*updateData.ISOCode) != "" && updateData.Country == nil {
-		name, _, _, _, iso, currency, _, _, err := fetchCountryDetails(*updateData.ISOCode)
-		if err == nil {
-			existing.Country = name
-			existing.ISOCode = strings.ToUpper(iso)
-			existing.Currency = strings.ToUpper(currency)
-			log.Printf("ISO updated via lookup: %s, Country: %s, Currency: %s", iso, name, currency)
+	} else if query != "" {
+		if lookupErr == nil {
+			applyCountry(&existing, country)
+			slog.DebugContext(r.Context(), "ISO updated via lookup", "id", id, "country", country.Name, "iso", country.ISO, "currency", country.Currency)
 		} else {
-			log.Printf("Warning: failed ISO lookup: %v", err)
+			slog.WarnContext(r.Context(), "failed ISO lookup", "id", id, "error", lookupErr)
 			existing.ISOCode = *updateData.ISOCode
 		}
 	}
 	if updateData.Currency != nil && strings.TrimSpace(*updateData.Currency) != "" {
-		existing.Currency = strings.ToUpper(*updateData.Currency)
+		existing.Currency = strings.ToUpper(strings.TrimSpace(*updateData.Currency))
+	} else if override != "" {
+		existing.Currency = override
 	}
 	if updateData.Features != nil {
 		if updateData.Features.Temperature != nil {
@@ -188,17 +289,112 @@ func handleUpdateRegistration(w http.ResponseWriter, r *http.Request) {
 		if updateData.Features.TargetCurrencies != nil {
 			existing.Features.TargetCurrencies = *updateData.Features.TargetCurrencies
 		}
+		if updateData.Features.Current != nil {
+			existing.Features.Current = *updateData.Features.Current
+		}
+		if updateData.Features.Today != nil {
+			existing.Features.Today = *updateData.Features.Today
+		}
+		if updateData.Features.Forecast != nil {
+			existing.Features.Forecast = *updateData.Features.Forecast
+		}
+		if updateData.Features.Wind != nil {
+			existing.Features.Wind = *updateData.Features.Wind
+		}
+		if updateData.Features.Humidity != nil {
+			existing.Features.Humidity = *updateData.Features.Humidity
+		}
+		if updateData.Features.CloudCover != nil {
+			existing.Features.CloudCover = *updateData.Features.CloudCover
+		}
+		if updateData.Features.UVIndex != nil {
+			existing.Features.UVIndex = *updateData.Features.UVIndex
+		}
+		if updateData.Features.Sun != nil {
+			existing.Features.Sun = *updateData.Features.Sun
+		}
+		if updateData.Features.AirQuality != nil {
+			existing.Features.AirQuality = *updateData.Features.AirQuality
+		}
+		if updateData.Features.CurrencyHistory != nil {
+			existing.Features.CurrencyHistory = *updateData.Features.CurrencyHistory
+		}
+		if updateData.Features.CurrencyChange != nil {
+			existing.Features.CurrencyChange = *updateData.Features.CurrencyChange
+		}
+		if updateData.Features.AllCurrencies != nil {
+			existing.Features.AllCurrencies = *updateData.Features.AllCurrencies
+		}
+		if updateData.Features.Languages != nil {
+			existing.Features.Languages = *updateData.Features.Languages
+		}
+		if updateData.Features.Borders != nil {
+			existing.Features.Borders = *updateData.Features.Borders
+		}
+		if updateData.Features.Region != nil {
+			existing.Features.Region = *updateData.Features.Region
+		}
+		if updateData.Features.Timezones != nil {
+			existing.Features.Timezones = *updateData.Features.Timezones
+		}
+		if updateData.Features.CallingCodes != nil {
+			existing.Features.CallingCodes = *updateData.Features.CallingCodes
+		}
+		if updateData.Features.Flag != nil {
+			existing.Features.Flag = *updateData.Features.Flag
+		}
+		if updateData.Features.DrivingSide != nil {
+			existing.Features.DrivingSide = *updateData.Features.DrivingSide
+		}
+		if updateData.Features.PopulationDensity != nil {
+			existing.Features.PopulationDensity = *updateData.Features.PopulationDensity
+		}
+	}
+	if updateData.Location != nil {
+		existing.Location = updateData.Location
+		if *updateData.Location == (Location{}) {
+			existing.Location = nil
+		}
+	}
+	if err := validateFeatures(existing.Features); err != nil {
+		appCache.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if updateData.Locations != nil {
+		existing.Locations = *updateData.Locations
+	}
+	if err := validateLocation(existing.Location); err != nil {
+		appCache.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateLocations(existing.Locations); err != nil {
+		appCache.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if updateData.Display != nil {
+		if err := updateData.Display.validate(); err != nil {
+			appCache.Unlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		existing.Display = updateData.Display
+		if *updateData.Display == (Display{}) {
+			existing.Display = nil
+		}
 	}
 	existing.LastChange = time.Now().Format("20060102 15:04")
 	appCache.Configs[id] = existing
 	appCache.Unlock()
-	log.Printf("Updated config for ID %s: %+v\n", id, existing)
-	if err := saveCache(); err != nil {
-		log.Println("Error saving cache:", err)
+	slog.InfoContext(r.Context(), "registration updated", "id", id)
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
 	}
 
 	// Trigger CHANGE webhook notifications.
-	sendWebhookNotification("CHANGE", existing.ISOCode)
+	sendWebhookNotification(r.Context(), existing.Owner, "CHANGE", existing.ISOCode, displayOf(existing.Display))
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -211,20 +407,20 @@ func handleDeleteRegistration(w http.ResponseWriter, r *http.Request) {
 	}
 	id := parts[4]
 	appCache.Lock()
-	if _, exists := appCache.Configs[id]; !exists {
+	config, exists := appCache.Configs[id]
+	if !exists || !canAccess(r.Context(), config.Owner) {
 		appCache.Unlock()
 		http.Error(w, "Configuration not found", http.StatusNotFound)
 		return
 	}
-	config := appCache.Configs[id]
 	delete(appCache.Configs, id)
 	appCache.Unlock()
-	if err := saveCache(); err != nil {
-		log.Println("Error saving cache:", err)
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
 	}
 
 	// Trigger DELETE webhook notifications.
-	sendWebhookNotification("DELETE", config.ISOCode)
+	sendWebhookNotification(r.Context(), config.Owner, "DELETE", config.ISOCode, displayOf(config.Display))
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -234,6 +430,9 @@ func HandleDashboard(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !requirePermission(w, r, permViewDashboards) {
+		return
+	}
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 5 || parts[4] == "" {
 		http.Error(w, "ID not provided", http.StatusBadRequest)
@@ -243,104 +442,257 @@ func HandleDashboard(w http.ResponseWriter, r *http.Request) {
 	appCache.RLock()
 	config, exists := appCache.Configs[id]
 	appCache.RUnlock()
-	if !exists {
+	if !exists || !canAccess(r.Context(), config.Owner) {
 		http.Error(w, "Configuration not found", http.StatusNotFound)
 		return
 	}
-	lookupKey := config.Country
-	if strings.TrimSpace(lookupKey) == "" {
-		lookupKey = config.ISOCode
-	}
-	_, cap, lat, lon, _, _, population, area, err := fetchCountryDetails(lookupKey)
-	if err != nil {
-		log.Printf("Error fetching country details: %v", err)
-		cap = "Unknown"
-		lat, lon = 0, 0
+	format, ok := requestFormat(w, r)
+	if !ok {
+		return
 	}
-	rates, err := fetchCurrencyRates(config.Currency)
+	display, err := displayFor(config.Display, r.URL.Query())
 	if err != nil {
-		log.Printf("Error fetching currency rates for base %s: %v", config.Currency, err)
-		rates = map[string]float64{}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	targetCurrencies := make(map[string]interface{})
-	for _, cur := range config.Features.TargetCurrencies {
-		if rate, ok := rates[cur]; ok {
-			targetCurrencies[cur] = rate
-		} else {
-			targetCurrencies[cur] = 1.0
+	opts := dashboardOptions{Display: display}
+	if raw := r.URL.Query().Get("amount"); raw != "" {
+		amount, err := parseAmount(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Amount = &amount
+	}
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		// The selection only applies to this request; the stored registration is unchanged.
+		fields, features, err := selectFeatures(config.Features, raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		config.Features, opts.Fields = features, fields
 	}
+	populated, _ := populateDashboard(r.Context(), config, opts)
 
-	var temperature, precipitation float64
-
-	city := config.Country
-	if city == "" {
-		city = lookupKey
+	setFormatHeaders(w, format)
+	if err := renderDashboard(w, format, populated); err != nil {
+		slog.WarnContext(r.Context(), "error writing dashboard", "format", format, "error", err)
 	}
 
-	if config.Features.Temperature || config.Features.Precipitation {
-		temp, precip, wErr := getWeather(city)
-		if wErr != nil {
-			log.Printf("Error fetching weather for %s: %v", city, wErr)
-		} else {
-			if config.Features.Temperature {
-				temperature = temp
-			}
-			if config.Features.Precipitation {
-				precipitation = precip
-			}
-		}
-	}
+	// Trigger INVOKE webhook notifications (done asynchronously so it does not block the response :3)
+	go sendWebhookNotification(r.Context(), config.Owner, "INVOKE", config.ISOCode, displayOf(config.Display))
+}
 
-	// Build the "populated" JSON with numeric placeholders from the real config + lookups.
-	populated := map[string]interface{}{
-		"country": config.Country,
-		"isoCode": config.ISOCode,
-		"features": map[string]interface{}{
-			"temperature":      temperature,
-			"precipitation":    precipitation,
-			"capital":          cap, // A real city name if found
-			"coordinates":      map[string]float64{"latitude": lat, "longitude": lon},
-			"population":       population,
-			"area":             area,
-			"targetCurrencies": targetCurrencies,
-		},
-		"lastRetrieval": time.Now().Format("20060102 15:04"),
+// dashboardOptions are the per-request settings of a populated dashboard.
+type dashboardOptions struct {
+	Amount  *float64 // Shows target currencies as this amount converted, instead of as rates.
+	Fields  []string // Narrows the features served to these; nil serves all enabled ones.
+	Display Display  // Units and formatting; the registration's own, with the request's on top.
+}
+
+// populateDashboard fetches the data for the enabled features of config. It returns the
+// dashboard as served to clients, and the feature set it was built from.
+func populateDashboard(ctx context.Context, config DashboardConfig, opts dashboardOptions) (*dashboardResponse, featureSet) {
+	lookupKey := config.Country
+	if strings.TrimSpace(lookupKey) == "" {
+		lookupKey = config.ISOCode
 	}
 
-	featuresMap := populated["features"].(map[string]interface{})
+	// Each upstream source falls back to its last known good value when it fails. When there is
+	// nothing to fall back on, the fields are null and the reason is listed under "unavailable".
+	fs := newFeatureSet()
+	sources, unavailable := fs.sources, fs.unavailable
 
-	if !config.Features.Capital {
-		delete(featuresMap, "capital")
-	}
+	country, status, countryOK := resolveCountry(ctx, lookupKey)
+	sources["countries"] = status
 
-	if !config.Features.Coordinates {
-		delete(featuresMap, "coordinates")
+	var rates map[string]float64
+	ratesOK := false
+	if len(config.Features.TargetCurrencies) > 0 {
+		fetched, err := fetchCurrencyRates(ctx, config.Currency)
+		if err != nil {
+			slog.WarnContext(ctx, "error fetching currency rates", "base", config.Currency, "error", err)
+		}
+		rates, status, ratesOK = lastRates.resolve(strings.ToUpper(config.Currency), fetched, err)
+		sources["currency"] = status
 	}
 
-	if !config.Features.Population {
-		delete(featuresMap, "population")
+	var location *weatherLocation
+	if wantsWeather(config.Features) {
+		loc, key, err := resolveWeatherLocation(ctx, config.Location, config.ISOCode, country, countryOK)
+		location = populateWeather(ctx, fs, config.Features, loc, key, err, opts.Display.imperial())
 	}
+	locations := populateLocations(ctx, config, opts.Display)
 
-	if !config.Features.Area {
-		delete(featuresMap, "area")
+	// setCountry is set for features taken from the country, whose offline record may not have
+	// the fields they need.
+	setCountry := func(enabled bool, feature string, value interface{}, fields ...string) {
+		if enabled && countryOK && country.lacks(fields...) {
+			fs.features[feature] = nil
+			unavailable[feature] = "not in the offline country dataset"
+			return
+		}
+		fs.set(enabled, feature, countryOK, "countries", value)
+	}
+	setCountry(config.Features.Capital, "capital", country.Capital, "capital")
+	setCountry(config.Features.Coordinates, "coordinates", map[string]float64{"latitude": country.Lat, "longitude": country.Lon}, "latlng")
+	setCountry(config.Features.Population, "population", country.Population, "population")
+	area := country.Area
+	if opts.Display.imperial() {
+		area *= squareMilesPerKm2
+	}
+	setCountry(config.Features.Area, "area", area, "area")
+	setCountry(config.Features.Languages, "languages", country.Languages, "languages")
+	setCountry(config.Features.Region, "region", map[string]string{"region": country.Region, "subregion": country.Subregion}, "region")
+	setCountry(config.Features.Timezones, "timezones", country.Timezones, "timezones")
+	setCountry(config.Features.CallingCodes, "callingCodes", country.CallingCodes, "idd")
+	setCountry(config.Features.Flag, "flag", map[string]string{"png": country.FlagPNG, "svg": country.FlagSVG, "emoji": country.FlagEmoji}, "flags")
+	setCountry(config.Features.DrivingSide, "drivingSide", country.DrivingSide, "car")
+	// Density is people per km² in any units, so it is taken from the area in km².
+	if config.Features.PopulationDensity && countryOK && country.Area <= 0 && !country.lacks("area") {
+		fs.features["populationDensity"] = nil
+		unavailable["populationDensity"] = "no area known for " + country.Name
+	} else {
+		density := country.Population / country.Area
+		if opts.Display.Decimals == nil {
+			// Rounded here only when the display settings do not round it already.
+			density = math.Round(density*100) / 100
+		}
+		setCountry(config.Features.PopulationDensity, "populationDensity", density, "population", "area")
 	}
-
-	if len(config.Features.TargetCurrencies) == 0 {
-		delete(featuresMap, "targetCurrencies")
+	if config.Features.Borders && countryOK && !country.lacks("borders") {
+		fs.features["borders"] = borderCountries(ctx, country.Borders)
+	} else {
+		setCountry(config.Features.Borders, "borders", nil, "borders")
 	}
 
-	if !config.Features.Temperature {
-		delete(featuresMap, "temperature")
-	}
+	if len(config.Features.TargetCurrencies) > 0 {
+		targetCurrencies := make(map[string]interface{})
+		for _, cur := range config.Features.TargetCurrencies {
+			if rate, ok := rates[cur]; ok && ratesOK {
+				if opts.Amount != nil {
+					rate *= *opts.Amount
+				}
+				targetCurrencies[cur] = rate
+			} else {
+				targetCurrencies[cur] = nil
+				if ratesOK {
+					unavailable["targetCurrencies."+cur] = "no rate for " + cur + " against " + config.Currency
+				}
+			}
+		}
+		fs.set(true, "targetCurrencies", ratesOK, "currency", targetCurrencies)
 
-	if !config.Features.Precipitation {
-		delete(featuresMap, "precipitation")
+		// History is served from what has been recorded, so it does not depend on the upstream.
+		history := map[string][]ratePoint{}
+		changes := map[string]rateChange{}
+		now := time.Now()
+		for _, cur := range config.Features.TargetCurrencies {
+			if days := config.Features.CurrencyHistory; days > 0 {
+				history[cur] = rateSeries(config.Currency, cur, days, now)
+			}
+			if config.Features.CurrencyChange {
+				// A week back needs eight days of points.
+				changes[cur] = changeOf(rateSeries(config.Currency, cur, 8, now))
+			}
+		}
+		fs.set(config.Features.CurrencyHistory > 0, "currencyHistory", true, "", history)
+		fs.set(config.Features.CurrencyChange, "currencyChange", true, "", changes)
+
+		if config.Features.AllCurrencies {
+			// Rates against every currency of the country, keyed by that currency. A currency
+			// without rates is left out and reported as unavailable.
+			perCurrency := map[string]map[string]interface{}{}
+			bases := config.Currencies
+			if len(bases) == 0 {
+				// Registrations made before all currencies were kept only know the primary one.
+				bases = []string{config.Currency}
+			}
+			for _, base := range bases {
+				baseRates, ok := rates, ratesOK
+				if base != config.Currency {
+					fetched, err := fetchCurrencyRates(ctx, base)
+					if err != nil {
+						slog.WarnContext(ctx, "error fetching currency rates", "base", base, "error", err)
+					}
+					baseRates, _, ok = lastRates.resolve(base, fetched, err)
+				}
+				if !ok {
+					unavailable["currencies."+base] = "currency rates unavailable for " + base
+					continue
+				}
+				targets := map[string]interface{}{}
+				for _, cur := range config.Features.TargetCurrencies {
+					rate, found := baseRates[cur]
+					if cur == base {
+						rate, found = 1, true
+					}
+					if !found {
+						targets[cur] = nil
+						continue
+					}
+					if opts.Amount != nil {
+						rate *= *opts.Amount
+					}
+					targets[cur] = rate
+				}
+				perCurrency[base] = targets
+			}
+			fs.set(true, "currencies", len(perCurrency) > 0, "currency", perCurrency)
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(populated)
+	populated := &dashboardResponse{
+		Country:       config.Country,
+		ISOCode:       config.ISOCode,
+		Features:      fs.features,
+		Location:      location,
+		Locations:     locations,
+		Sources:       sources,
+		Units:         opts.Display.units(),
+		LastRetrieval: opts.Display.formatTime(time.Now()),
+	}
+	if opts.Amount != nil && len(config.Features.TargetCurrencies) > 0 {
+		populated.Amount = &dashboardAmount{Value: *opts.Amount, Currency: config.Currency}
+	}
+	if len(unavailable) > 0 {
+		populated.Unavailable = unavailable
+	}
+	if opts.Fields != nil {
+		populated.only(opts.Fields)
+	}
+	opts.Display.round(populated.Features)
+	return populated, fs
+}
 
-	// Trigger INVOKE webhook notifications (done asynchronously so it does not block the response :3)
-	go sendWebhookNotification("INVOKE", config.ISOCode)
+// borderCountry is a neighbouring country on a dashboard.
+type borderCountry struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// borderCountries resolves the names of neighbouring countries. A name that cannot be looked
+// up is left as the code, so the borders are still shown.
+func borderCountries(ctx context.Context, codes []string) []borderCountry {
+	borders := make([]borderCountry, len(codes))
+	if len(codes) == 0 {
+		return borders
+	}
+	fetched, err := fetchCountryNames(ctx, codes)
+	if err != nil {
+		slog.WarnContext(ctx, "error fetching border country names", "codes", codes, "error", err)
+	}
+	names, _, ok := lastNames.resolve(strings.Join(codes, ","), fetched, err)
+	if !ok && countryDataMode() == countryDataFallback {
+		names, _ = offlineNames(codes)
+	}
+	for i, code := range codes {
+		name, ok := names[strings.ToUpper(code)]
+		if !ok {
+			name = code
+		}
+		borders[i] = borderCountry{Code: code, Name: name}
+	}
+	return borders
 }
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --------------------------
+// Dashboard Response
+// --------------------------
+
+// dashboardResponse is a populated dashboard as served to clients. Features are keyed by the
+// names used in Features; a disabled feature is left out and an unavailable one is null.
+// Features stays an untyped map: each feature has a value of its own shape, and the formats
+// and fields= work on it by key.
+type dashboardResponse struct {
+	Registration  string                   `json:"registration,omitempty"` // Set on comparison rows.
+	Country       string                   `json:"country"`
+	ISOCode       string                   `json:"isoCode"`
+	Amount        *dashboardAmount         `json:"amount,omitempty"`
+	Features      map[string]interface{}   `json:"features"`
+	Location      *weatherLocation         `json:"location,omitempty"`
+	Locations     []map[string]interface{} `json:"locations,omitempty"`
+	Sources       map[string]sourceStatus  `json:"sources"`
+	Unavailable   map[string]string        `json:"unavailable,omitempty"`
+	Units         string                   `json:"units"` // "metric" or "imperial".
+	LastRetrieval string                   `json:"lastRetrieval"`
+}
+
+// dashboardAmount is the amount of the country's currency target currencies were converted for.
+type dashboardAmount struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+}
+
+// Defaults for features with a setting, when fields= turns them on for one request.
+const (
+	defaultFieldForecastDays    = 3
+	defaultFieldCurrencyHistory = 30
+)
+
+// currencyFields need the target currencies of the registration.
+var currencyFields = map[string]bool{"targetCurrencies": true, "currencyHistory": true, "currencyChange": true, "allCurrencies": true}
+
+// featureOutputKeys maps the features whose output key differs from their name.
+var featureOutputKeys = map[string]string{"allCurrencies": "currencies"}
+
+// featureSelectors turns one feature, by name, on in selected, with its setting from stored.
+var featureSelectors = map[string]func(selected *Features, stored Features){
+	"temperature":      func(f *Features, _ Features) { f.Temperature = true },
+	"precipitation":    func(f *Features, _ Features) { f.Precipitation = true },
+	"capital":          func(f *Features, _ Features) { f.Capital = true },
+	"coordinates":      func(f *Features, _ Features) { f.Coordinates = true },
+	"population":       func(f *Features, _ Features) { f.Population = true },
+	"area":             func(f *Features, _ Features) { f.Area = true },
+	"targetCurrencies": func(f *Features, stored Features) { f.TargetCurrencies = stored.TargetCurrencies },
+	"current":          func(f *Features, _ Features) { f.Current = true },
+	"today":            func(f *Features, _ Features) { f.Today = true },
+	"forecast": func(f *Features, stored Features) {
+		f.Forecast = stored.Forecast
+		if f.Forecast.Days == 0 {
+			f.Forecast.Days = defaultFieldForecastDays
+		}
+	},
+	"wind":       func(f *Features, _ Features) { f.Wind = true },
+	"humidity":   func(f *Features, _ Features) { f.Humidity = true },
+	"cloudCover": func(f *Features, _ Features) { f.CloudCover = true },
+	"uvIndex":    func(f *Features, _ Features) { f.UVIndex = true },
+	"sun":        func(f *Features, _ Features) { f.Sun = true },
+	"airQuality": func(f *Features, _ Features) { f.AirQuality = true },
+	"currencyHistory": func(f *Features, stored Features) {
+		f.CurrencyHistory = stored.CurrencyHistory
+		if f.CurrencyHistory == 0 {
+			f.CurrencyHistory = defaultFieldCurrencyHistory
+		}
+	},
+	"currencyChange":    func(f *Features, _ Features) { f.CurrencyChange = true },
+	"allCurrencies":     func(f *Features, _ Features) { f.AllCurrencies = true },
+	"languages":         func(f *Features, _ Features) { f.Languages = true },
+	"borders":           func(f *Features, _ Features) { f.Borders = true },
+	"region":            func(f *Features, _ Features) { f.Region = true },
+	"timezones":         func(f *Features, _ Features) { f.Timezones = true },
+	"callingCodes":      func(f *Features, _ Features) { f.CallingCodes = true },
+	"flag":              func(f *Features, _ Features) { f.Flag = true },
+	"drivingSide":       func(f *Features, _ Features) { f.DrivingSide = true },
+	"populationDensity": func(f *Features, _ Features) { f.PopulationDensity = true },
+}
+
+// selectFeatures parses a fields= parameter, a comma separated list of feature names. It
+// returns the names and the features to populate: only the listed ones, with those not enabled
+// on the registration turned on using their settings from stored or a default.
+func selectFeatures(stored Features, raw string) ([]string, Features, error) {
+	var selected Features
+	var fields []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		selectFeature, ok := featureSelectors[name]
+		if !ok {
+			return nil, selected, fmt.Errorf("unknown field %q", name)
+		}
+		fields = append(fields, name)
+		selectFeature(&selected, stored)
+		if currencyFields[name] {
+			if len(stored.TargetCurrencies) == 0 {
+				return nil, selected, fmt.Errorf("field %q needs targetCurrencies on the registration", name)
+			}
+			selected.TargetCurrencies = stored.TargetCurrencies
+		}
+	}
+	if len(fields) == 0 {
+		return nil, selected, fmt.Errorf("fields must list at least one feature")
+	}
+	return fields, selected, nil
+}
+
+// only narrows d to the features named in fields, with their unavailable reasons. Features
+// that were only populated because another one depends on them are dropped.
+func (d *dashboardResponse) only(fields []string) {
+	keep := map[string]bool{}
+	for _, name := range fields {
+		if key, ok := featureOutputKeys[name]; ok {
+			name = key
+		}
+		keep[name] = true
+	}
+	for key := range d.Features {
+		if !keep[key] {
+			delete(d.Features, key)
+		}
+	}
+	for key := range d.Unavailable {
+		if !keep[strings.SplitN(key, ".", 2)[0]] {
+			delete(d.Unavailable, key)
+		}
+	}
+	if len(d.Unavailable) == 0 {
+		d.Unavailable = nil
+	}
+	if !keep["targetCurrencies"] && !keep["currencies"] {
+		d.Amount = nil
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Timezones work in containers without zoneinfo.
+)
+
+// --------------------------
+// Display Settings
+// --------------------------
+
+// Values of Display.Units and Display.TimeFormat.
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+	timeRFC3339   = "rfc3339"
+	timeUnix      = "unix"
+	timeLegacy    = "legacy"
+)
+
+// legacyTimeLayout is the format timestamps had before they could be chosen.
+const legacyTimeLayout = "20060102 15:04"
+
+// maxDecimals caps Display.Decimals.
+const maxDecimals = 10
+
+// squareMilesPerKm2 converts areas, which the countries API only reports in square kilometres.
+const squareMilesPerKm2 = 0.386102
+
+// validate normalizes the units and time format of d and checks every setting.
+func (d *Display) validate() error {
+	d.Units = strings.ToLower(strings.TrimSpace(d.Units))
+	d.TimeFormat = strings.ToLower(strings.TrimSpace(d.TimeFormat))
+	d.Timezone = strings.TrimSpace(d.Timezone)
+	switch d.Units {
+	case "", unitsMetric, unitsImperial:
+	default:
+		return fmt.Errorf("units must be %q or %q", unitsMetric, unitsImperial)
+	}
+	switch d.TimeFormat {
+	case "", timeRFC3339, timeUnix, timeLegacy:
+	default:
+		return fmt.Errorf("timeFormat must be %q, %q or %q", timeRFC3339, timeUnix, timeLegacy)
+	}
+	if d.Timezone != "" {
+		if _, err := time.LoadLocation(d.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", d.Timezone)
+		}
+	}
+	if d.Decimals != nil && (*d.Decimals < 0 || *d.Decimals > maxDecimals) {
+		return fmt.Errorf("decimals must be between 0 and %d", maxDecimals)
+	}
+	return nil
+}
+
+// displayFor returns the stored display settings of a registration, which may be nil, with
+// those given as units=, timeFormat=, timezone= and decimals= in query overriding them.
+func displayFor(stored *Display, query url.Values) (Display, error) {
+	var d Display
+	if stored != nil {
+		d = *stored
+	}
+	if raw := query.Get("units"); raw != "" {
+		d.Units = raw
+	}
+	if raw := query.Get("timeFormat"); raw != "" {
+		d.TimeFormat = raw
+	}
+	if raw := query.Get("timezone"); raw != "" {
+		d.Timezone = raw
+	}
+	if raw := query.Get("decimals"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return d, fmt.Errorf("decimals must be a whole number")
+		}
+		d.Decimals = &n
+	}
+	return d, d.validate()
+}
+
+// imperial reports whether d asks for imperial units.
+func (d Display) imperial() bool {
+	return d.Units == unitsImperial
+}
+
+// units is the name of the unit system of d.
+func (d Display) units() string {
+	if d.imperial() {
+		return unitsImperial
+	}
+	return unitsMetric
+}
+
+// formatTime renders t in the timezone and format of d. Settings are assumed to be validated;
+// an unknown timezone falls back to UTC.
+func (d Display) formatTime(t time.Time) string {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	switch d.TimeFormat {
+	case timeUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case timeLegacy:
+		return t.Format(legacyTimeLayout)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// displayOf is the display settings of a registration, the defaults when it has none.
+func displayOf(d *Display) Display {
+	if d == nil {
+		return Display{}
+	}
+	return *d
+}
+
+// round rounds every number in features to the decimals of d, when set. Values are converted to
+// their JSON form, so it is done last, once nothing reads the features any more.
+func (d Display) round(features map[string]interface{}) {
+	if d.Decimals == nil {
+		return
+	}
+	scale := math.Pow(10, float64(*d.Decimals))
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case float64:
+			return math.Round(v*scale) / scale
+		case map[string]interface{}:
+			for key, inner := range v {
+				v[key] = walk(inner)
+			}
+		case []interface{}:
+			for i, inner := range v {
+				v[i] = walk(inner)
+			}
+		}
+		return v
+	}
+	for key, value := range features {
+		features[key] = walk(generic(value))
+	}
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"assignment_02/api"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// upstreamDependencies maps the dependency names used in configuration to the URL that is probed.
+// Each is a small request the API answers with 200 when it is healthy.
+var upstreamDependencies = map[string]string{
+	"countries":  api.CountriesProbe,
+	"meteo":      api.WeatherProbe,
+	"currency":   api.CurrencyApiStatus,
+	"airquality": api.AirQualityProbe,
+}
+
+// ReadinessConfig controls which upstream dependencies must be reachable for /readyz to report ready.
+type ReadinessConfig struct {
+	CriticalDependencies []string      // Names from upstreamDependencies.
+	Budget               time.Duration // Total time allowed for probing all critical dependencies.
+	Err                  error         // Set when the configuration could not be parsed or is invalid.
+}
+
+// LoadReadinessConfig reads READY_CRITICAL_DEPS (comma separated, e.g. "countries,currency")
+// and READY_TIMEOUT (e.g. "2s") from the environment.
+func LoadReadinessConfig() ReadinessConfig {
+	cfg := ReadinessConfig{CriticalDependencies: envList("READY_CRITICAL_DEPS", "")}
+	budget, err := envDuration("READY_TIMEOUT", 2*time.Second)
+	if err != nil {
+		cfg.Err = fmt.Errorf("invalid READY_TIMEOUT: %w", err)
+		return cfg
+	}
+	if budget <= 0 {
+		cfg.Err = fmt.Errorf("READY_TIMEOUT must be positive")
+		return cfg
+	}
+	cfg.Budget = budget
+	for _, dep := range cfg.CriticalDependencies {
+		if _, ok := upstreamDependencies[dep]; !ok {
+			cfg.Err = fmt.Errorf("unknown dependency %q in READY_CRITICAL_DEPS", dep)
+			return cfg
+		}
+	}
+	return cfg
+}
+
+var readinessConfig = LoadReadinessConfig()
+
+// HandleHealthz reports that the process is alive. It never touches storage or upstream APIs.
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// HandleReadyz reports whether the service can take traffic: storage is loaded,
+// configuration is valid and every critical dependency answers within the budget.
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	checks := map[string]string{}
+	ready := true
+
+	if cacheLoaded() {
+		checks["storage"] = "ok"
+	} else {
+		checks["storage"] = "not loaded"
+		ready = false
+	}
+
+	if readinessConfig.Err != nil {
+		checks["config"] = readinessConfig.Err.Error()
+		ready = false
+	} else {
+		checks["config"] = "ok"
+		for dep, result := range probeDependencies(r.Context(), readinessConfig.CriticalDependencies, readinessConfig.Budget) {
+			checks[dep] = result
+			if result != "ok" {
+				ready = false
+			}
+		}
+	}
+
+	status := http.StatusOK
+	state := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		state = "not ready"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": state,
+		"checks": checks,
+	})
+}
+
+// probeDependencies pings the named dependencies concurrently and returns "ok" or an error description per name.
+func probeDependencies(parent context.Context, deps []string, budget time.Duration) map[string]string {
+	ctx, cancel := context.WithTimeout(parent, budget)
+	defer cancel()
+
+	results := make(map[string]string, len(deps))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, dep := range deps {
+		wg.Add(1)
+		go func(dep string) {
+			defer wg.Done()
+			result := "ok"
+			if err := probe(ctx, upstreamDependencies[dep]); err != nil {
+				result = err.Error()
+			}
+			mu.Lock()
+			results[dep] = result
+			mu.Unlock()
+		}(dep)
+	}
+	wg.Wait()
+	return results
+}
+
+func probe(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+	return nil
+}
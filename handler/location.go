@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// --------------------------
+// Weather Locations
+// --------------------------
+
+// weatherLocation is the place the dashboard weather was taken for, as reported to clients.
+type weatherLocation struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Source    string  `json:"source"` // "coordinates", "city", "capital" or "country".
+}
+
+// validateLocation checks a location given on a registration.
+func validateLocation(loc *Location) error {
+	if loc == nil {
+		return nil
+	}
+	if (loc.Latitude == nil) != (loc.Longitude == nil) {
+		return fmt.Errorf("location needs both latitude and longitude")
+	}
+	if loc.Latitude != nil && (*loc.Latitude < -90 || *loc.Latitude > 90) {
+		return fmt.Errorf("location latitude must be between -90 and 90")
+	}
+	if loc.Longitude != nil && (*loc.Longitude < -180 || *loc.Longitude > 180) {
+		return fmt.Errorf("location longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// maxLocations caps the extra locations on one registration, since each costs upstream calls.
+const maxLocations = 10
+
+// validateLocations checks the extra locations of a registration. Each one needs a city or
+// coordinates, and their names must be unique.
+func validateLocations(locs []Location) error {
+	if len(locs) > maxLocations {
+		return fmt.Errorf("at most %d locations are allowed", maxLocations)
+	}
+	seen := map[string]bool{}
+	for _, loc := range locs {
+		if err := validateLocation(&loc); err != nil {
+			return err
+		}
+		name := loc.label()
+		if name == "" {
+			return fmt.Errorf("every location needs a name or a city")
+		}
+		if loc.Latitude == nil && strings.TrimSpace(loc.City) == "" {
+			return fmt.Errorf("location %q needs a city or coordinates", name)
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("location %q is listed twice", name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+	return nil
+}
+
+// label is the name a location is shown under.
+func (l Location) label() string {
+	if name := strings.TrimSpace(l.Name); name != "" {
+		return name
+	}
+	return strings.TrimSpace(l.City)
+}
+
+// resolveWeatherLocation picks where to take the weather: the given coordinates or city if
+// set, otherwise the capital, otherwise the centre of the country. key identifies the location
+// for the last known good weather cache, even when err is set.
+func resolveWeatherLocation(ctx context.Context, want *Location, isoCode string, country countryInfo, countryOK bool) (loc weatherLocation, key string, err error) {
+	switch {
+	case want != nil && want.Latitude != nil:
+		loc = weatherLocation{
+			Name:      want.label(),
+			Latitude:  *want.Latitude,
+			Longitude: *want.Longitude,
+			Source:    "coordinates",
+		}
+	case want != nil && strings.TrimSpace(want.City) != "":
+		city := strings.TrimSpace(want.City)
+		key = "city:" + strings.ToLower(city) + ":" + strings.ToLower(isoCode)
+		loc, err = geocodeCity(ctx, city, isoCode)
+		loc.Source = "city"
+		return loc, key, err
+	case countryOK && country.HasCapitalLatLon:
+		loc = weatherLocation{Name: country.Capital, Latitude: country.CapitalLat, Longitude: country.CapitalLon, Source: "capital"}
+	case countryOK && !country.lacks("latlng"):
+		loc = weatherLocation{Name: country.Name, Latitude: country.Lat, Longitude: country.Lon, Source: "country"}
+	case countryOK:
+		return loc, "", fmt.Errorf("no location for the weather, the offline country dataset has no coordinates for %s", country.Name)
+	default:
+		return loc, "", fmt.Errorf("no location for the weather, country details unavailable")
+	}
+	return loc, fmt.Sprintf("%.3f,%.3f", loc.Latitude, loc.Longitude), nil
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --------------------------
+// Structured Logging and Request IDs
+// --------------------------
+
+// RequestIDHeader is read from incoming requests and set on responses, upstream calls and webhook deliveries.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// SetupLogging installs the default slog logger. LOG_LEVEL selects debug, info, warn or error
+// (default info) and LOG_FORMAT selects text or json (default text).
+func SetupLogging() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(envOr("LOG_LEVEL", "info"))); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var base slog.Handler
+	if strings.EqualFold(envOr("LOG_FORMAT", "text"), "json") {
+		base = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		base = slog.NewTextHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{base}))
+}
+
+// contextHandler adds the request ID stored in the context to every record logged with it.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID returns a copy of ctx carrying the given request ID.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return generateID()
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestLogging assigns every request an ID (reusing a sane incoming X-Request-ID),
+// echoes it in the response and logs the request once it completes.
+func WithRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(r.Header.Get(RequestIDHeader))
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		ctx := withRequestID(r.Context(), id)
+		w.Header().Set(RequestIDHeader, id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds())
+	})
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// --------------------------
+// Prometheus Metrics
+// --------------------------
+
+// defaultBuckets are the histogram upper bounds in seconds, matching the Prometheus client defaults.
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// counterVec is a monotonically increasing counter partitioned by label values.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	c.mu.Lock()
+	c.values[strings.Join(labelValues, "\xff")]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key, "", ""), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec tracks observations in cumulative buckets partitioned by label values.
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // One per bucket, non-cumulative.
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: defaultBuckets, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, "", ""), s.count)
+	}
+}
+
+// gaugeFunc reports a value computed at scrape time.
+type gaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+func (g gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value()))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelEscaper escapes label values the way the Prometheus text format expects.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders {a="x",b="y"} from the joined label key, optionally appending one extra label.
+func formatLabels(names []string, key, extraName, extraValue string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			if i < len(names) {
+				pairs = append(pairs, names[i]+`="`+labelEscaper.Replace(value)+`"`)
+			}
+		}
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+labelEscaper.Replace(extraValue)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	httpRequestsTotal = newCounterVec("dashboard_http_requests_total",
+		"HTTP requests handled, by route, method and status code.", "route", "method", "status")
+	httpRequestDuration = newHistogramVec("dashboard_http_request_duration_seconds",
+		"HTTP request latency, by route, method and status code.", "route", "method", "status")
+	upstreamRequestDuration = newHistogramVec("dashboard_upstream_request_duration_seconds",
+		"Latency of calls to upstream APIs, by API.", "api")
+	upstreamErrorsTotal = newCounterVec("dashboard_upstream_errors_total",
+		"Failed calls to upstream APIs (transport errors and non-200 responses), by API.", "api")
+	upstreamSharedTotal = newCounterVec("dashboard_upstream_shared_total",
+		"Upstream calls answered by an identical call of the same batch, by API.", "api")
+	webhookDeliveriesTotal = newCounterVec("dashboard_webhook_deliveries_total",
+		"Webhook delivery attempts, by event and outcome.", "event", "outcome")
+	cacheLookupsTotal = newCounterVec("dashboard_cache_lookups_total",
+		"Lookups in the caches of upstream data (last known good values and the country index), by cache and result (hit or miss).", "cache", "result")
+)
+
+var gauges = []gaugeFunc{
+	{"dashboard_registrations", "Number of stored dashboard registrations.", func() float64 {
+		appCache.RLock()
+		defer appCache.RUnlock()
+		return float64(len(appCache.Configs))
+	}},
+	{"dashboard_webhooks", "Number of registered webhooks.", func() float64 {
+		appCache.RLock()
+		defer appCache.RUnlock()
+		return float64(len(appCache.Webhooks))
+	}},
+}
+
+// HandleMetrics exposes all metrics in the Prometheus text format.
+func HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	httpRequestsTotal.write(w)
+	httpRequestDuration.write(w)
+	upstreamRequestDuration.write(w)
+	upstreamErrorsTotal.write(w)
+	upstreamSharedTotal.write(w)
+	webhookDeliveriesTotal.write(w)
+	cacheLookupsTotal.write(w)
+	for _, g := range gauges {
+		g.write(w)
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Instrument wraps a handler so its requests are counted, timed and traced under the given route label.
+func Instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, span := startServerSpan(r, route)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(ctx))
+		status, method := strconv.Itoa(rec.status), methodLabel(r.Method)
+		httpRequestsTotal.inc(route, method, status)
+		httpRequestDuration.observe(time.Since(start).Seconds(), route, method, status)
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+		span.End()
+	}
+}
+
+// methodLabel is the method label of a request: the methods the API serves, and OTHER for the
+// rest, so clients cannot create a series per made-up method.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return method
+	}
+	return "OTHER"
+}
+
+// recordCacheLookup counts a hit or miss for the named cache.
+func recordCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookupsTotal.inc(cache, result)
+}
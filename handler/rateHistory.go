@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------------
+// Exchange Rate History
+// --------------------------
+
+// rateHistoryDays is how long observed exchange rates are kept.
+const rateHistoryDays = 365
+
+// dailyRates maps a UTC date (2006-01-02) to the rates against one base currency on that day.
+// The last rate observed on a day is the one kept.
+type dailyRates map[string]map[string]float64
+
+// ratePoint is one day of a currency pair's time series.
+type ratePoint struct {
+	Date string  `json:"date"`
+	Rate float64 `json:"rate"`
+}
+
+// rateChange is the percent change of a rate since the previous day and week, when known.
+type rateChange struct {
+	Day  *float64 `json:"day"`
+	Week *float64 `json:"week"`
+}
+
+const dateLayout = "2006-01-02"
+
+// recordRates stores the rates observed for base today and drops days older than
+// rateHistoryDays. The cache is only saved for the first observation of a day.
+func recordRates(ctx context.Context, base string, rates map[string]float64, now time.Time) {
+	base = strings.ToUpper(base)
+	today := now.UTC().Format(dateLayout)
+	cutoff := now.UTC().AddDate(0, 0, -rateHistoryDays).Format(dateLayout)
+
+	observed := make(map[string]float64, len(rates))
+	for target, rate := range rates {
+		observed[strings.ToUpper(target)] = rate
+	}
+	appCache.Lock()
+	history, ok := appCache.RateHistory[base]
+	if !ok {
+		history = dailyRates{}
+		appCache.RateHistory[base] = history
+	}
+	_, seen := history[today]
+	history[today] = observed
+	for date := range history {
+		if date < cutoff {
+			delete(history, date)
+		}
+	}
+	appCache.Unlock()
+
+	if !seen {
+		if err := saveCache(ctx); err != nil {
+			slog.ErrorContext(ctx, "error saving cache", "error", err)
+		}
+	}
+}
+
+// rateSeries returns the recorded rates of target against base over the last days days,
+// oldest first. When nothing was recorded for base, the inverse of the rates recorded for
+// target against base is used.
+func rateSeries(base, target string, days int, now time.Time) []ratePoint {
+	base, target = strings.ToUpper(base), strings.ToUpper(target)
+	cutoff := now.UTC().AddDate(0, 0, -days+1).Format(dateLayout)
+
+	appCache.RLock()
+	defer appCache.RUnlock()
+	series := []ratePoint{}
+	collect := func(history dailyRates, currency string, invert bool) {
+		for date, rates := range history {
+			rate, ok := rates[currency]
+			if !ok || date < cutoff || rate == 0 {
+				continue
+			}
+			if invert {
+				rate = 1 / rate
+			}
+			series = append(series, ratePoint{Date: date, Rate: rate})
+		}
+	}
+	if base == target {
+		return series
+	}
+	collect(appCache.RateHistory[base], target, false)
+	if len(series) == 0 {
+		collect(appCache.RateHistory[target], base, true)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Date < series[j].Date })
+	return series
+}
+
+// changeOf computes the percent change from the last rate on or before 1 and 7 days before
+// the latest point of series.
+func changeOf(series []ratePoint) rateChange {
+	var change rateChange
+	if len(series) == 0 {
+		return change
+	}
+	latest := series[len(series)-1]
+	day, err := time.Parse(dateLayout, latest.Date)
+	if err != nil {
+		return change
+	}
+	since := func(days int) *float64 {
+		before := day.AddDate(0, 0, -days).Format(dateLayout)
+		for i := len(series) - 1; i >= 0; i-- {
+			if series[i].Date <= before {
+				pct := math.Round((latest.Rate/series[i].Rate-1)*100*100) / 100
+				return &pct
+			}
+		}
+		return nil
+	}
+	change.Day = since(1)
+	change.Week = since(7)
+	return change
+}
+
+// HandleRates serves the recorded time series of a currency pair at
+// /dashboard/v1/rates/{from}/{to}?days=30.
+func HandleRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requirePermission(w, r, permViewDashboards) {
+		return
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 || !isCurrencyCode(parts[4]) || !isCurrencyCode(parts[5]) {
+		http.Error(w, "Expected /dashboard/v1/rates/{from}/{to} with three-letter currency codes", http.StatusBadRequest)
+		return
+	}
+	from, to := strings.ToUpper(parts[4]), strings.ToUpper(parts[5])
+	days := 30
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > rateHistoryDays {
+			http.Error(w, "days must be between 1 and "+strconv.Itoa(rateHistoryDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	// Fetching the latest rates records today's observation; history is served even if this fails.
+	if _, err := fetchCurrencyRates(r.Context(), from); err != nil {
+		slog.WarnContext(r.Context(), "error fetching currency rates", "base", from, "error", err)
+	}
+	series := rateSeries(from, to, days, time.Now())
+	if len(series) == 0 {
+		http.Error(w, "No rates recorded for "+from+"/"+to, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"base":   from,
+		"target": to,
+		"days":   days,
+		"series": series,
+		"change": changeOf(series),
+	})
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------
+// Per-Client Rate Limiting and Daily Quotas
+// --------------------------
+
+// bucket is a token bucket: it holds up to capacity tokens and refills at rate tokens per second.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// routeLimiter keeps one bucket per client for a single route.
+type routeLimiter struct {
+	capacity float64
+	rate     float64 // Tokens per second.
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	swept    time.Time
+}
+
+// allow takes a token for client if one is available. It returns the tokens left, how long
+// until the bucket is full again and, when denied, how long until the next token.
+func (l *routeLimiter) allow(client string, now time.Time) (ok bool, remaining int, reset, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, exists := l.buckets[client]
+	if !exists {
+		b = &bucket{tokens: l.capacity, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.capacity, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retryAfter = time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	reset = time.Duration((l.capacity - b.tokens) / l.rate * float64(time.Second))
+	return ok, int(b.tokens), reset, retryAfter
+}
+
+// sweep forgets buckets that have been idle long enough to be full again, at most once a minute.
+func (l *routeLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	full := time.Duration(l.capacity / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// quotaTracker counts requests per client per UTC day.
+type quotaTracker struct {
+	mu    sync.Mutex
+	day   string
+	usage map[string]int
+}
+
+var dailyQuota = quotaTracker{usage: make(map[string]int)}
+
+// QuotaLimit returns the number of requests each client may make per UTC day, read from
+// DAILY_QUOTA (default 10000). Zero or less disables the quota.
+func QuotaLimit() int {
+	limit, err := strconv.Atoi(envOr("DAILY_QUOTA", "10000"))
+	if err != nil {
+		return 10000
+	}
+	return limit
+}
+
+// take counts n requests for client, unless that would exceed limit.
+func (q *quotaTracker) take(client string, n, limit int, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(now)
+	if limit > 0 && q.usage[client]+n > limit {
+		return false
+	}
+	q.usage[client] += n
+	return true
+}
+
+func (q *quotaTracker) used(client string, now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(now)
+	return q.usage[client]
+}
+
+func (q *quotaTracker) snapshot(now time.Time) map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(now)
+	usage := make(map[string]int, len(q.usage))
+	for client, n := range q.usage {
+		usage[client] = n
+	}
+	return usage
+}
+
+func (q *quotaTracker) rollover(now time.Time) {
+	if day := now.UTC().Format("2006-01-02"); day != q.day {
+		q.day = day
+		q.usage = make(map[string]int)
+	}
+}
+
+// untilMidnightUTC is the time left until the daily quota resets.
+func untilMidnightUTC(now time.Time) time.Duration {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(now)
+}
+
+// clientID identifies the caller by API key when a valid one is presented, otherwise by IP address.
+func clientID(r *http.Request) string {
+	if presented := credentialFrom(r); presented != "" {
+		if key, ok := lookupAPIKey(presented); ok {
+			return "key:" + key.ID
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimit wraps a handler with a per-client token bucket and the daily quota. The bucket
+// size is read from RATE_LIMIT_<ROUTE> in requests per minute (default RATE_LIMIT_DEFAULT, 60).
+func RateLimit(route string, next http.HandlerFunc) http.HandlerFunc {
+	envKey := "RATE_LIMIT_" + strings.ToUpper(route)
+	perMinute, err := strconv.Atoi(envOr(envKey, envOr("RATE_LIMIT_DEFAULT", "60")))
+	if err != nil || perMinute <= 0 {
+		slog.Warn("invalid rate limit, using 60 requests per minute", "route", route, "variable", envKey)
+		perMinute = 60
+	}
+	limiter := &routeLimiter{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		buckets:  make(map[string]*bucket),
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		client := clientID(r)
+
+		ok, remaining, reset, retryAfter := limiter.allow(client, now)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(perMinute))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", seconds(reset))
+		if !ok {
+			w.Header().Set("Retry-After", seconds(retryAfter))
+			slog.WarnContext(r.Context(), "rate limit exceeded", "route", route, "client", client)
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		limit := QuotaLimit()
+		if !dailyQuota.take(client, 1, limit, now) {
+			w.Header().Set("Retry-After", seconds(untilMidnightUTC(now)))
+			slog.WarnContext(r.Context(), "daily quota exceeded", "client", client)
+			http.Error(w, fmt.Sprintf("Daily quota of %d requests exceeded", limit), http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// HandleQuota reports the caller's usage of the daily quota. Admins see every client.
+func HandleQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requirePermission(w, r, permViewDashboards) {
+		return
+	}
+	now := time.Now()
+	limit := QuotaLimit()
+	usage := func(client string, used int) map[string]interface{} {
+		entry := map[string]interface{}{
+			"client": client,
+			"used":   used,
+			"limit":  limit,
+			"reset":  int(math.Ceil(untilMidnightUTC(now).Seconds())),
+		}
+		if limit > 0 {
+			entry["remaining"] = int(math.Max(0, float64(limit-used)))
+		}
+		return entry
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if isAdmin(r.Context()) && r.URL.Query().Get("all") == "true" {
+		snapshot := dailyQuota.snapshot(now)
+		clients := make([]string, 0, len(snapshot))
+		for client := range snapshot {
+			clients = append(clients, client)
+		}
+		sort.Strings(clients)
+		all := []map[string]interface{}{}
+		for _, client := range clients {
+			all = append(all, usage(client, snapshot[client]))
+		}
+		json.NewEncoder(w).Encode(all)
+		return
+	}
+	client := clientID(r)
+	json.NewEncoder(w).Encode(usage(client, dailyQuota.used(client, now)))
+}
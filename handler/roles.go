@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+// --------------------------
+// Role-Based Access Control
+// --------------------------
+
+// Role is attached to an API key and decides what the key may do.
+type Role string
+
+const (
+	RoleViewer Role = "viewer" // May only view populated dashboards.
+	RoleEditor Role = "editor" // May also manage registrations and webhooks and view status.
+	RoleAdmin  Role = "admin"  // May do everything, on every owner's resources, and manage keys.
+)
+
+type permission int
+
+const (
+	permViewDashboards permission = iota
+	permManageRegistrations
+	permManageWebhooks
+	permViewStatus
+	permManageKeys
+)
+
+var rolePermissions = map[Role][]permission{
+	RoleViewer: {permViewDashboards},
+	RoleEditor: {permViewDashboards, permManageRegistrations, permManageWebhooks, permViewStatus},
+	RoleAdmin:  {permViewDashboards, permManageRegistrations, permManageWebhooks, permViewStatus, permManageKeys},
+}
+
+// validRole reports whether role is one of the known roles.
+func validRole(role Role) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// effectiveRole returns the key's role. Keys issued before roles existed had full access to
+// their own resources, so they are treated as editors.
+func (k APIKey) effectiveRole() Role {
+	if k.Role == "" {
+		return RoleEditor
+	}
+	return k.Role
+}
+
+// can reports whether the role of k has the given permission.
+func (k APIKey) can(perm permission) bool {
+	for _, p := range rolePermissions[k.effectiveRole()] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the caller in ctx has the given permission.
+func allowed(ctx context.Context, perm permission) bool {
+	key := caller(ctx)
+	return key.ID != "" && key.can(perm)
+}
+
+// requirePermission writes 403 Forbidden and returns false if the caller lacks perm.
+func requirePermission(w http.ResponseWriter, r *http.Request, perm permission) bool {
+	if allowed(r.Context(), perm) {
+		return true
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// isAdmin reports whether the caller has the admin role.
+func isAdmin(ctx context.Context) bool {
+	key := caller(ctx)
+	return key.ID != "" && key.effectiveRole() == RoleAdmin
+}
+
+// principal returns the owner ID that new resources created by the caller get.
+func principal(ctx context.Context) string {
+	key := caller(ctx)
+	if key.Owner != "" {
+		return key.Owner
+	}
+	return key.ID
+}
@@ -10,6 +10,10 @@ const API_BASE = "/dashboard/v1";
  */
 async function apiRequest(method, endpoint, data = null) {
   const options = { method, headers: {} };
+  const apiKey = localStorage.getItem("apiKey");
+  if (apiKey) {
+    options.headers["X-API-Key"] = apiKey;
+  }
   if (data) {
     options.headers["Content-Type"] = "application/json";
     options.body = JSON.stringify(data);
@@ -32,6 +36,48 @@ async function apiRequest(method, endpoint, data = null) {
   }
 }
 
+/**
+ * Stores the API key in the browser so it is sent with every request.
+ */
+function saveApiKey() {
+  const key = document.getElementById("apiKeyInput").value.trim();
+  if (key) {
+    localStorage.setItem("apiKey", key);
+    document.getElementById("apiKeyResult").innerHTML = "API key saved.";
+  } else {
+    localStorage.removeItem("apiKey");
+    document.getElementById("apiKeyResult").innerHTML = "API key removed.";
+  }
+}
+
+let suggestTimer = null;
+
+/**
+ * Fills the country suggestions of the register field while the user types.
+ * Waits a moment after the last keystroke so not every letter is a request.
+ */
+function suggestCountries(query) {
+  clearTimeout(suggestTimer);
+  if (query.trim().length < 2) {
+    return;
+  }
+  suggestTimer = setTimeout(async () => {
+    try {
+      const matches = await apiRequest("GET", `/countries?q=${encodeURIComponent(query.trim())}&limit=8`);
+      const list = document.getElementById("countrySuggestions");
+      list.innerHTML = "";
+      matches.forEach(match => {
+        const option = document.createElement("option");
+        option.value = match.name;
+        option.label = `${match.name} (${match.isoCode})`;
+        list.appendChild(option);
+      });
+    } catch (error) {
+      // Suggestions are a convenience, typing the name still works without them.
+    }
+  }, 250);
+}
+
 /**
  * Registers a new dashboard configuration.
  */
@@ -137,6 +183,27 @@ function getFeaturesFromForm() {
     coordinates: document.getElementById("coordinatesCheckbox").checked,
     population: document.getElementById("populationCheckbox").checked,
     area: document.getElementById("areaCheckbox").checked,
+    current: document.getElementById("currentCheckbox").checked,
+    today: document.getElementById("todayCheckbox").checked,
+    wind: document.getElementById("windCheckbox").checked,
+    humidity: document.getElementById("humidityCheckbox").checked,
+    cloudCover: document.getElementById("cloudCoverCheckbox").checked,
+    uvIndex: document.getElementById("uvIndexCheckbox").checked,
+    sun: document.getElementById("sunCheckbox").checked,
+    airQuality: document.getElementById("airQualityCheckbox").checked,
+    allCurrencies: document.getElementById("allCurrenciesCheckbox").checked,
+    languages: document.getElementById("languagesCheckbox").checked,
+    borders: document.getElementById("bordersCheckbox").checked,
+    region: document.getElementById("regionCheckbox").checked,
+    timezones: document.getElementById("timezonesCheckbox").checked,
+    callingCodes: document.getElementById("callingCodesCheckbox").checked,
+    flag: document.getElementById("flagCheckbox").checked,
+    drivingSide: document.getElementById("drivingSideCheckbox").checked,
+    populationDensity: document.getElementById("populationDensityCheckbox").checked,
+    forecast: {
+      days: parseInt(document.getElementById("forecastDaysInput").value, 10) || 0,
+      resolution: document.getElementById("forecastResolutionSelect").value
+    },
     // For target currencies, we expect the user to input a valid JSON string.
     targetCurrencies: JSON.parse(
       document.getElementById("targetCurrenciesInput").value.trim() || "[]"
@@ -174,6 +241,10 @@ async function editDashboardConfig() {
   }
   // Always include features from the form, since they now have explicit booleans.
   requestData.features = features;
+  const unitsVal = document.getElementById("unitsSelect").value;
+  if (unitsVal) {
+    requestData.display = { units: unitsVal };
+  }
 
   // If nothing is provided, alert.
   if (Object.keys(requestData).length === 0) {
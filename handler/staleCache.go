@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// --------------------------
+// Last Known Good Values
+// --------------------------
+
+// sourceStatus tells dashboard clients where the data from one upstream source came from.
+type sourceStatus struct {
+	Stale   bool   `json:"stale"`
+	Age     int    `json:"age,omitempty"`     // Seconds since the value was retrieved, when stale.
+	Error   string `json:"error,omitempty"`   // Why the upstream could not be used.
+	Offline bool   `json:"offline,omitempty"` // Served from the embedded country dataset.
+}
+
+type stamped[T any] struct {
+	value T
+	at    time.Time
+}
+
+// lastGood remembers the most recent successful result per key, so it can be served
+// (marked stale) when the upstream fails.
+type lastGood[T any] struct {
+	name   string
+	mu     sync.RWMutex
+	values map[string]stamped[T]
+}
+
+func newLastGood[T any](name string) *lastGood[T] {
+	return &lastGood[T]{name: name, values: make(map[string]stamped[T])}
+}
+
+// resolve stores value when err is nil. Otherwise it falls back to the last known good value.
+// ok is false when there is neither a fresh nor a stale value.
+func (c *lastGood[T]) resolve(key string, value T, err error) (result T, status sourceStatus, ok bool) {
+	now := time.Now()
+	if err == nil {
+		c.mu.Lock()
+		c.values[key] = stamped[T]{value: value, at: now}
+		c.mu.Unlock()
+		return value, sourceStatus{}, true
+	}
+	c.mu.RLock()
+	last, found := c.values[key]
+	c.mu.RUnlock()
+	recordCacheLookup(c.name, found)
+	if !found {
+		return result, sourceStatus{Error: err.Error()}, false
+	}
+	return last.value, sourceStatus{Stale: true, Age: int(now.Sub(last.at).Seconds()), Error: err.Error()}, true
+}
+
+var (
+	lastCountries = newLastGood[countryInfo]("stale_countries")
+	lastRates     = newLastGood[map[string]float64]("stale_currency")
+	lastWeather   = newLastGood[weatherReport]("stale_weather")
+	lastAir       = newLastGood[airQuality]("stale_airquality")
+	lastNames     = newLastGood[map[string]string]("stale_country_names")
+)
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"assignment_02/api"
+	"context"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -12,6 +13,9 @@ var HttpClient = http.DefaultClient
 // Handler for the status endpoint
 // This function checks the status of various APIs and returns their status as a JSON response
 func HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if !requirePermission(w, r, permViewStatus) {
+		return
+	}
 	// Ping the API
 	status := func(url string) int {
 		resp, err := HttpClient.Get(url)
@@ -34,10 +38,24 @@ func HandleStatus(w http.ResponseWriter, r *http.Request) {
 		"meteo_api":       meteoStatus,
 		"currency_api":    currencyStatus,
 		"notification_db": 200,
-		"webhooks":        len(appCache.Webhooks),
+		"webhooks":        countWebhooks(r.Context()),
+		"circuitBreakers": breakerStatuses(),
 		"version":         "v1",
 		"uptime":          int(time.Since(startTime).Seconds()),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
+
+// countWebhooks counts the webhooks visible to the caller; admins see the total.
+func countWebhooks(ctx context.Context) int {
+	appCache.RLock()
+	defer appCache.RUnlock()
+	count := 0
+	for _, wh := range appCache.Webhooks {
+		if canAccess(ctx, wh.Owner) {
+			count++
+		}
+	}
+	return count
+}
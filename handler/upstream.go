@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// --------------------------
+// Upstream API Calls
+// --------------------------
+
+// upstreamGet performs a GET against an upstream API, forwarding the request ID and trace context
+// from ctx, and records its latency and errors under apiName. Calls are refused with ErrCircuitOpen
+// while the API's circuit breaker is open and are subject to its outbound rate limit. Within a
+// context from withUpstreamMemo, each URL is only fetched once.
+func upstreamGet(ctx context.Context, apiName, url string) (*http.Response, error) {
+	if memo, ok := ctx.Value(upstreamMemoKey{}).(*upstreamMemo); ok {
+		return memo.get(ctx, apiName, url)
+	}
+	return fetchUpstream(ctx, apiName, url)
+}
+
+func fetchUpstream(ctx context.Context, apiName, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	guard := guardFor(apiName)
+	if err := guard.acquire(ctx, apiName); err != nil {
+		upstreamErrorsTotal.inc(apiName)
+		slog.DebugContext(ctx, "upstream call refused", "api", apiName, "error", err)
+		return nil, err
+	}
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	req, span := startClientSpan(req, "GET "+apiName, attribute.String("upstream.api", apiName))
+	start := time.Now()
+	resp, err := HttpClient.Do(req)
+	upstreamRequestDuration.observe(time.Since(start).Seconds(), apiName)
+
+	callErr := err
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode != http.StatusOK {
+			callErr = fmt.Errorf("%s returned status %d", apiName, resp.StatusCode)
+		}
+	}
+	// Only outages count against the breaker; a 404 for an unknown country is a valid answer,
+	// and a call abandoned by our own caller says nothing about the upstream.
+	if err != nil && ctx.Err() != nil {
+		guard.breaker.release()
+	} else {
+		guard.done(ctx, apiName, err == nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests)
+	}
+	if callErr != nil {
+		upstreamErrorsTotal.inc(apiName)
+		slog.WarnContext(ctx, "upstream call failed", "api", apiName, "error", callErr)
+	} else {
+		slog.DebugContext(ctx, "upstream call", "api", apiName, "duration_ms", time.Since(start).Milliseconds())
+	}
+	endSpan(span, callErr)
+	return resp, err
+}
+
+type upstreamMemoKey struct{}
+
+// upstreamMemo shares upstream responses between the calls made with one context, so work that
+// needs the same country, rates or weather several times, like a batch of dashboards, asks the
+// upstream once. Concurrent calls for a URL wait for the first one.
+type upstreamMemo struct {
+	mu    sync.Mutex
+	calls map[string]*memoCall
+}
+
+// memoCall is the outcome of one upstream call, with the body read so it can be served again.
+type memoCall struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   []byte
+	err    error
+}
+
+// withUpstreamMemo returns a context in which upstreamGet fetches every URL only once.
+func withUpstreamMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, upstreamMemoKey{}, &upstreamMemo{calls: map[string]*memoCall{}})
+}
+
+func (m *upstreamMemo) get(ctx context.Context, apiName, url string) (*http.Response, error) {
+	m.mu.Lock()
+	call, shared := m.calls[url]
+	if !shared {
+		call = &memoCall{done: make(chan struct{})}
+		m.calls[url] = call
+	}
+	m.mu.Unlock()
+
+	if shared {
+		upstreamSharedTotal.inc(apiName)
+		<-call.done
+	} else {
+		resp, err := fetchUpstream(ctx, apiName, url)
+		call.err = err
+		if err == nil {
+			call.status, call.header = resp.StatusCode, resp.Header
+			call.body, call.err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		close(call.done)
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", call.status, http.StatusText(call.status)),
+		StatusCode: call.status,
+		Header:     call.header.Clone(),
+		Body:       io.NopCloser(bytes.NewReader(call.body)),
+	}, nil
+}
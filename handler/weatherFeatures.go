@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// --------------------------
+// Weather Features
+// --------------------------
+
+// featureSet collects the features of a dashboard. Enabled features whose source had nothing
+// to offer are set to null, with the reason listed under unavailable.
+type featureSet struct {
+	features    map[string]interface{}
+	sources     map[string]sourceStatus
+	unavailable map[string]string
+}
+
+func newFeatureSet() featureSet {
+	return featureSet{features: map[string]interface{}{}, sources: map[string]sourceStatus{}, unavailable: map[string]string{}}
+}
+
+func (s featureSet) set(enabled bool, field string, ok bool, source string, value interface{}) {
+	if !enabled {
+		return
+	}
+	if !ok {
+		s.features[field] = nil
+		s.unavailable[field] = s.sources[source].Error
+		return
+	}
+	s.features[field] = value
+}
+
+// wantsWeather reports whether any feature needs the weather API.
+func wantsWeather(f Features) bool {
+	return f.Temperature || f.Precipitation || f.Current || f.Today || f.Forecast.Days > 0 ||
+		f.Wind || f.Humidity || f.CloudCover || f.UVIndex || f.Sun || f.AirQuality
+}
+
+// populateWeather fetches the weather, and air quality when enabled, at loc and adds the
+// enabled weather features to fs. locErr is the error from resolving loc, if any. It returns
+// the location the served weather belongs to, or nil when there is none.
+func populateWeather(ctx context.Context, fs featureSet, f Features, loc weatherLocation, key string, locErr error, imperial bool) *weatherLocation {
+	var fetched weatherReport
+	err := locErr
+	if err == nil {
+		fetched, err = getWeather(ctx, loc, f.Forecast.Days, imperial)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "error fetching weather", "location", loc.Name, "source", loc.Source, "error", err)
+	}
+	// Weather for another unit system or forecast is kept apart, so a fallback never serves a
+	// forecast of the wrong length or units.
+	weatherKey := fmt.Sprintf("%s|%d|%s", key, f.Forecast.Days, f.Forecast.resolution())
+	if imperial {
+		weatherKey += "|" + unitsImperial
+	}
+	weather, status, weatherOK := lastWeather.resolve(weatherKey, fetched, err)
+	fs.sources["weather"] = status
+
+	// Air quality is looked up at the coordinates the weather was taken at.
+	var air airQuality
+	airOK := false
+	if f.AirQuality && weatherOK {
+		fetched, err := getAirQuality(ctx, weather.Location.Latitude, weather.Location.Longitude)
+		if err != nil {
+			slog.WarnContext(ctx, "error fetching air quality", "location", weather.Location.Name, "error", err)
+		}
+		air, status, airOK = lastAir.resolve(key, fetched, err)
+		fs.sources["airQuality"] = status
+	} else if f.AirQuality {
+		fs.sources["airQuality"] = sourceStatus{Error: "no coordinates: " + status.Error}
+	}
+
+	fs.set(f.Temperature, "temperature", weatherOK, "weather", weather.Current.Temperature)
+	fs.set(f.Precipitation, "precipitation", weatherOK, "weather", weather.Current.Precipitation)
+	fs.set(f.Current, "current", weatherOK, "weather", map[string]interface{}{
+		"time":          weather.Current.Time,
+		"timezone":      weather.Timezone,
+		"temperature":   weather.Current.Temperature,
+		"precipitation": weather.Current.Precipitation,
+	})
+	var today dailyWeather
+	if len(weather.Daily) > 0 {
+		today = weather.Daily[0]
+	}
+	// setToday is set for features taken from today's daily aggregates, which may be missing.
+	setToday := func(enabled bool, field string, value interface{}) {
+		if enabled && weatherOK && len(weather.Daily) == 0 {
+			fs.features[field] = nil
+			fs.unavailable[field] = "weather API returned no daily aggregates"
+			return
+		}
+		fs.set(enabled, field, weatherOK, "weather", value)
+	}
+	setToday(f.Today, "today", today)
+	setToday(f.Sun, "sun", map[string]string{"sunrise": today.Sunrise, "sunset": today.Sunset, "timezone": weather.Timezone})
+	fs.set(f.Forecast.Days > 0, "forecast", weatherOK, "weather", forecastSeries(weather, f.Forecast))
+	fs.set(f.Wind, "wind", weatherOK, "weather", map[string]measurement{
+		"speed":     weather.Conditions.WindSpeed,
+		"direction": weather.Conditions.WindDirection,
+	})
+	fs.set(f.Humidity, "humidity", weatherOK, "weather", weather.Conditions.Humidity)
+	fs.set(f.CloudCover, "cloudCover", weatherOK, "weather", weather.Conditions.CloudCover)
+	fs.set(f.UVIndex, "uvIndex", weatherOK, "weather", weather.Conditions.UVIndex)
+	fs.set(f.AirQuality, "airQuality", airOK, "airQuality", air)
+
+	if !weatherOK {
+		return nil
+	}
+	return &weather.Location
+}
+
+// populateLocations builds the weather features for each extra location of a registration.
+// The locations are fetched concurrently, in the units of display, and returned in the order
+// they were registered.
+func populateLocations(ctx context.Context, config DashboardConfig, display Display) []map[string]interface{} {
+	if len(config.Locations) == 0 || !wantsWeather(config.Features) {
+		return nil
+	}
+	results := make([]map[string]interface{}, len(config.Locations))
+	var wg sync.WaitGroup
+	for i, want := range config.Locations {
+		wg.Add(1)
+		go func(i int, want Location) {
+			defer wg.Done()
+			fs := newFeatureSet()
+			loc, key, err := resolveWeatherLocation(ctx, &want, config.ISOCode, countryInfo{}, false)
+			result := map[string]interface{}{
+				"name":     want.label(),
+				"features": fs.features,
+				"sources":  fs.sources,
+			}
+			if served := populateWeather(ctx, fs, config.Features, loc, key, err, display.imperial()); served != nil {
+				result["location"] = served
+			}
+			display.round(fs.features)
+			if len(fs.unavailable) > 0 {
+				result["unavailable"] = fs.unavailable
+			}
+			results[i] = result
+		}(i, want)
+	}
+	wg.Wait()
+	return results
+}
+
+// resolution is the resolution of the forecast, daily unless hourly was asked for.
+func (forecast ForecastFeature) resolution() string {
+	if forecast.Resolution == "" {
+		return "daily"
+	}
+	return forecast.Resolution
+}
+
+// forecastSeries cuts the requested number of days out of report, as hourly samples or daily aggregates.
+func forecastSeries(report weatherReport, forecast ForecastFeature) map[string]interface{} {
+	resolution := forecast.resolution()
+	var series interface{}
+	if resolution == "hourly" {
+		series = report.Hourly[:min(len(report.Hourly), forecast.Days*24)]
+	} else {
+		series = report.Daily[:min(len(report.Daily), forecast.Days)]
+	}
+	return map[string]interface{}{
+		"days":       forecast.Days,
+		"resolution": resolution,
+		"timezone":   report.Timezone,
+		"series":     series,
+	}
+}
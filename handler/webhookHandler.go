@@ -2,60 +2,146 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func sendWebhookNotification(event, country string) {
+// webhookDelivery is a payload due to one webhook.
+type webhookDelivery struct {
+	webhook Webhook
+	event   string
+	data    []byte
+}
+
+// sendWebhookNotification delivers event to every matching webhook, with the time formatted by
+// the display settings of the registration. Deliveries outlive the request that triggered them,
+// so only the request ID is kept from ctx, not its cancellation.
+func sendWebhookNotification(ctx context.Context, owner, event, country string, display Display) {
+	ctx = context.WithoutCancel(ctx)
+	for _, d := range webhookDeliveries(ctx, owner, event, country, display) {
+		// Sender POST-kallet asynkront
+		go deliverWebhook(ctx, d)
+	}
+}
+
+// sendWebhookNotifications delivers the deliveries of several notifications, at most workers
+// at a time, so that a batch of dashboards does not open a connection per webhook at once.
+func sendWebhookNotifications(ctx context.Context, deliveries []webhookDelivery, workers int) {
+	ctx = context.WithoutCancel(ctx)
+	jobs := make(chan webhookDelivery)
+	var wg sync.WaitGroup
+	for range min(workers, len(deliveries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				deliverWebhook(ctx, d)
+			}
+		}()
+	}
+	for _, d := range deliveries {
+		jobs <- d
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// webhookDeliveries prepares the payload of event for every matching webhook.
+func webhookDeliveries(ctx context.Context, owner, event, country string, display Display) []webhookDelivery {
 	appCache.RLock()
 	var webhooks []Webhook
 	for _, wh := range appCache.Webhooks {
 		// Sjekker om webhooken er abonnert på denne hendelsen
 		// og om webhookens land er enten tomt (global) eller matcher et land.
-		if strings.EqualFold(wh.Event, event) && (strings.TrimSpace(wh.Country) == "" || strings.EqualFold(wh.Country, country)) {
+		// Kun webhooks som tilhører samme API-nøkkel som registreringen blir varslet.
+		if wh.Owner == owner && strings.EqualFold(wh.Event, event) && (strings.TrimSpace(wh.Country) == "" || strings.EqualFold(wh.Country, country)) {
 			webhooks = append(webhooks, wh)
 		}
 	}
 	appCache.RUnlock()
 
+	var deliveries []webhookDelivery
 	for _, wh := range webhooks {
 		// Forbereder payloaden for avsending
 		payload := map[string]string{
 			"id":      wh.ID,
 			"country": country,
 			"event":   event,
-			"time":    time.Now().Format("20060102 15:04"),
+			"time":    display.formatTime(time.Now()),
 		}
 		jsonData, err := json.Marshal(payload)
 		if err != nil {
-			log.Println("Error marshaling webhook payload:", err)
+			slog.ErrorContext(ctx, "error marshaling webhook payload", "webhook", wh.ID, "error", err)
 			continue
 		}
-		// Sender POST-kallet asynkront
-		go func(wh Webhook, data []byte) {
-			resp, err := http.Post(wh.URL, "application/json", bytes.NewBuffer(data))
-			if err != nil {
-				log.Println("Error sending webhook to", wh.URL, ":", err)
-				return
-			}
-			resp.Body.Close()
-		}(wh, jsonData)
+		deliveries = append(deliveries, webhookDelivery{webhook: wh, event: event, data: jsonData})
+	}
+	return deliveries
+}
+
+// deliverWebhook posts d to its webhook and records the outcome.
+func deliverWebhook(ctx context.Context, d webhookDelivery) {
+	wh, event := d.webhook, d.event
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewBuffer(d.data))
+	if err != nil {
+		webhookDeliveriesTotal.inc(event, "error")
+		slog.WarnContext(ctx, "invalid webhook URL", "webhook", wh.ID, "url", wh.URL, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	req, span := startClientSpan(req, "POST webhook",
+		attribute.String("webhook.id", wh.ID),
+		attribute.String("webhook.event", event))
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		webhookDeliveriesTotal.inc(event, "error")
+		slog.WarnContext(ctx, "error sending webhook", "webhook", wh.ID, "url", wh.URL, "error", err)
+		endSpan(span, err)
+		return
+	}
+	resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		webhookDeliveriesTotal.inc(event, "success")
+		slog.DebugContext(ctx, "webhook delivered", "webhook", wh.ID, "event", event)
+		endSpan(span, nil)
+	} else {
+		webhookDeliveriesTotal.inc(event, "rejected")
+		slog.WarnContext(ctx, "webhook rejected", "webhook", wh.ID, "url", wh.URL, "status", resp.StatusCode)
+		endSpan(span, fmt.Errorf("webhook returned status %d", resp.StatusCode))
 	}
 }
 
 func NotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePermission(w, r, permManageWebhooks) {
+		return
+	}
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) > 4 && pathParts[4] != "" {
 		switch r.Method {
 		case http.MethodGet:
-			handleGetWebhook(w, r)
-			addDocument(w, r)
+			if webhook, ok := handleGetWebhook(w, r); ok {
+				if err := storeWebhookDocument(r.Context(), webhook); err != nil {
+					slog.WarnContext(r.Context(), "error storing webhook in Firestore", "webhook", webhook.ID, "error", err)
+				}
+			}
 		case http.MethodDelete:
-			handleDeleteWebhook(w, r)
-			deleteDocument(w, r)
+			if id, ok := handleDeleteWebhook(w, r); ok {
+				if err := deleteWebhookDocument(r.Context(), id); err != nil {
+					slog.WarnContext(r.Context(), "error deleting webhook from Firestore", "webhook", id, "error", err)
+				}
+			}
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
@@ -77,12 +163,21 @@ func handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if query := strings.TrimSpace(webhook.Country); query != "" {
+		// Events carry the two-letter code, so names and other codes are stored in that form.
+		if country, err := lookupCountry(r.Context(), query); err == nil {
+			webhook.Country = strings.ToUpper(country.ISO)
+		} else {
+			slog.WarnContext(r.Context(), "webhook country kept as given", "country", query, "error", err)
+		}
+	}
 	webhook.ID = generateID()
+	webhook.Owner = principal(r.Context())
 	appCache.Lock()
 	appCache.Webhooks[webhook.ID] = webhook
 	appCache.Unlock()
-	if err := saveCache(); err != nil {
-		log.Println("Error saving cache:", err)
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -94,47 +189,55 @@ func handleListWebhooks(w http.ResponseWriter, r *http.Request) {
 	defer appCache.RUnlock()
 	var webhooks []Webhook
 	for _, wh := range appCache.Webhooks {
-		webhooks = append(webhooks, wh)
+		if canAccess(r.Context(), wh.Owner) {
+			webhooks = append(webhooks, wh)
+		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(webhooks)
 }
 
-func handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+// handleGetWebhook serves a webhook of the caller and returns it, reporting false when an
+// error was written instead.
+func handleGetWebhook(w http.ResponseWriter, r *http.Request) (Webhook, bool) {
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 5 || parts[4] == "" {
 		http.Error(w, "ID not provided", http.StatusBadRequest)
-		return
+		return Webhook{}, false
 	}
 	id := parts[4]
 	appCache.RLock()
 	webhook, exists := appCache.Webhooks[id]
 	appCache.RUnlock()
-	if !exists {
+	if !exists || !canAccess(r.Context(), webhook.Owner) {
 		http.Error(w, "Webhook not found", http.StatusNotFound)
-		return
+		return Webhook{}, false
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(webhook)
+	return webhook, true
 }
 
-func handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+// handleDeleteWebhook deletes a webhook of the caller and returns its ID, reporting false when
+// an error was written instead.
+func handleDeleteWebhook(w http.ResponseWriter, r *http.Request) (string, bool) {
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 5 || parts[4] == "" {
 		http.Error(w, "ID not provided", http.StatusBadRequest)
-		return
+		return "", false
 	}
 	id := parts[4]
 	appCache.Lock()
-	if _, exists := appCache.Webhooks[id]; !exists {
+	if webhook, exists := appCache.Webhooks[id]; !exists || !canAccess(r.Context(), webhook.Owner) {
 		appCache.Unlock()
 		http.Error(w, "Webhook not found", http.StatusNotFound)
-		return
+		return "", false
 	}
 	delete(appCache.Webhooks, id)
 	appCache.Unlock()
-	if err := saveCache(); err != nil {
-		log.Println("Error saving cache:", err)
+	if err := saveCache(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error saving cache", "error", err)
 	}
 	w.WriteHeader(http.StatusNoContent)
+	return id, true
 }
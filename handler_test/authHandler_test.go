@@ -0,0 +1,203 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createKey issues an API key with the given role through the admin endpoint and returns the plaintext key.
+func createKey(t *testing.T, name, role string) string {
+	t.Helper()
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	req := httptest.NewRequest(http.MethodPost, "/dashboard/v1/admin/keys/", strings.NewReader(`{"name":"`+name+`","role":"`+role+`"}`))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	handler.KeysHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating key, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	return created.Key
+}
+
+func TestAPIKeyOwnership(t *testing.T) {
+	useTransport(t, stubTransport(`[{"name":{"common":"Norway"},"cca2":"NO","currencies":{"NOK":{}}}]`))
+
+	alice := createKey(t, "alice", "editor")
+	bob := createKey(t, "bob", "editor")
+	h := handler.RequireAPIKey(handler.RegistrationHandler)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(handler.APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/dashboard/v1/registrations/", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without key, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/dashboard/v1/registrations/", "dk_wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with unknown key, got %d", rec.Code)
+	}
+
+	rec := do(http.MethodPost, "/dashboard/v1/registrations/", alice, `{"isoCode":"no"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var config handler.DashboardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	if rec := do(http.MethodGet, "/dashboard/v1/registrations/"+config.ID, alice, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected owner to get status 200, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/dashboard/v1/registrations/"+config.ID, bob, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected other key to get status 404, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/dashboard/v1/registrations/"+config.ID, bob, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected other key to get status 404 on delete, got %d", rec.Code)
+	}
+
+	var listed []handler.DashboardConfig
+	rec = do(http.MethodGet, "/dashboard/v1/registrations/", bob, "")
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(listed) != 0 {
+		t.Errorf("Expected other key to list no registrations, got %d", len(listed))
+	}
+}
+
+func TestRoles(t *testing.T) {
+	viewer := createKey(t, "viewer", "viewer")
+	editor := createKey(t, "editor", "editor")
+	admin := createKey(t, "admin", "admin")
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+		key     string
+		want    int
+	}{
+		{"viewer cannot list registrations", handler.RegistrationHandler, http.MethodGet, "/dashboard/v1/registrations/", viewer, http.StatusForbidden},
+		{"viewer cannot list webhooks", handler.NotificationHandler, http.MethodGet, "/dashboard/v1/notifications/", viewer, http.StatusForbidden},
+		{"viewer cannot view status", handler.HandleStatus, http.MethodGet, "/dashboard/v1/status/", viewer, http.StatusForbidden},
+		{"viewer can view dashboards", handler.HandleDashboard, http.MethodGet, "/dashboard/v1/dashboards/missing", viewer, http.StatusNotFound},
+		{"viewer can view their quota", handler.HandleQuota, http.MethodGet, "/dashboard/v1/quota/", viewer, http.StatusOK},
+		{"editor can list registrations", handler.RegistrationHandler, http.MethodGet, "/dashboard/v1/registrations/", editor, http.StatusOK},
+		{"editor cannot manage keys", handler.KeysHandler, http.MethodGet, "/dashboard/v1/admin/keys/", editor, http.StatusForbidden},
+		{"admin can manage keys", handler.KeysHandler, http.MethodGet, "/dashboard/v1/admin/keys/", admin, http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set(handler.APIKeyHeader, c.key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(c.handler)(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.want, rec.Code)
+		}
+	}
+}
+
+func TestLegacyOwner(t *testing.T) {
+	// Registrations stored before API keys existed have no owner and are given to LEGACY_OWNER.
+	name := fmt.Sprintf("legacy-%d", time.Now().UnixNano())
+	key := createKey(t, name, "editor")
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/admin/keys/", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	handler.KeysHandler(rec, req)
+	var keys []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&keys); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	var id string
+	for _, k := range keys {
+		if k.Name == name {
+			id = k.ID
+		}
+	}
+
+	writeCacheFile(t, `{"configs":{"legacy-1":{"id":"legacy-1","isoCode":"NO"}},"webhooks":{}}`)
+
+	get := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/registrations/legacy-1", nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.RegistrationHandler)(rec, req)
+		return rec.Code
+	}
+
+	if err := handler.LoadCache(); err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+	if code := get(); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a record without owner, got %d", code)
+	}
+
+	t.Setenv("LEGACY_OWNER", id)
+	if err := handler.LoadCache(); err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Errorf("Expected status 200 once the record is given to LEGACY_OWNER, got %d", code)
+	}
+}
+
+func TestWebhookOwnership(t *testing.T) {
+	useTransport(t, stubTransport(`[{"name":{"common":"Norway"},"cca2":"NO","currencies":{"NOK":{}}}]`))
+	alice := createKey(t, "hook-owner", "editor")
+	bob := createKey(t, "hook-other", "editor")
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.NotificationHandler)(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/dashboard/v1/notifications/", alice, `{"url":"http://example.com/hook","country":"NO","event":"INVOKE"}`)
+	var webhook handler.Webhook
+	if err := json.NewDecoder(rec.Body).Decode(&webhook); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	path := "/dashboard/v1/notifications/" + webhook.ID
+
+	// Another key gets a plain 404 and nothing else is done.
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if rec := do(method, path, bob, ""); rec.Code != http.StatusNotFound || rec.Body.String() != "Webhook not found\n" {
+			t.Errorf("%s by another key: expected only a 404, got %d: %q", method, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec = do(http.MethodGet, path, alice, "")
+	var got handler.Webhook
+	decoder := json.NewDecoder(rec.Body)
+	if err := decoder.Decode(&got); err != nil || got.ID != webhook.ID || decoder.More() {
+		t.Errorf("Expected only the webhook, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, path, alice, ""); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("Expected an empty 204 deleting the webhook, got %d: %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,140 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock runs the breakers and outbound rate limits on a clock the test moves by hand.
+func fakeClock(t *testing.T) *time.Time {
+	t.Helper()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	old := handler.UpstreamClock
+	handler.UpstreamClock = func() time.Time { return now }
+	t.Cleanup(func() { handler.UpstreamClock = old })
+	return &now
+}
+
+// breakerTest converts from CHF, which only the tests in this file ask the currency API about.
+type breakerTest struct {
+	t   *testing.T
+	key string
+}
+
+// convert asks for a conversion through rt and returns how many calls reached the currency API.
+func (bt breakerTest) convert(rt http.RoundTripper) int {
+	bt.t.Helper()
+	recorder := &recordingTransport{next: rt}
+	useTransport(bt.t, recorder)
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/convert?from=CHF&to=EUR", nil)
+	req.Header.Set(handler.APIKeyHeader, bt.key)
+	handler.RequireAPIKey(handler.HandleConvert)(httptest.NewRecorder(), req)
+	calls := 0
+	for _, u := range recorder.requested() {
+		if strings.Contains(u, "/currency/CHF") {
+			calls++
+		}
+	}
+	return calls
+}
+
+// state reads the state of the currency API's breaker from the status endpoint.
+func (bt breakerTest) state() string {
+	bt.t.Helper()
+	useTransport(bt.t, routeTransport{})
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/status/", nil)
+	req.Header.Set(handler.APIKeyHeader, bt.key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.HandleStatus)(rec, req)
+	var status struct {
+		CircuitBreakers map[string]struct {
+			State string `json:"state"`
+		} `json:"circuitBreakers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		bt.t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	return status.CircuitBreakers["currency"].State
+}
+
+var chfRates = routeTransport{{"/currency/CHF", `{"rates":{"EUR":1.04}}`}}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Setenv("UPSTREAM_BREAKER_FAILURES", "2")
+	t.Setenv("UPSTREAM_BREAKER_COOLDOWN", "30s")
+	resetBreakers(t)
+	now := fakeClock(t)
+	bt := breakerTest{t, createKey(t, "breaker", "editor")}
+
+	// Closed, failures are let through until there are enough in a row to open it.
+	for i := 0; i < 2; i++ {
+		if calls := bt.convert(unavailableTransport{}); calls != 1 {
+			t.Fatalf("Call %d: expected the closed breaker to let it through, got %d calls", i+1, calls)
+		}
+	}
+	if state := bt.state(); state != "open" {
+		t.Fatalf("Expected the breaker to open after two failures, got %s", state)
+	}
+	if calls := bt.convert(chfRates); calls != 0 {
+		t.Errorf("Expected the open breaker to refuse the call, got %d calls", calls)
+	}
+
+	// After the cooldown a single probe is let through, and a failing one opens it again.
+	*now = now.Add(31 * time.Second)
+	if calls := bt.convert(unavailableTransport{}); calls != 1 {
+		t.Errorf("Expected a probe after the cooldown, got %d calls", calls)
+	}
+	if state := bt.state(); state != "open" {
+		t.Errorf("Expected a failed probe to open the breaker again, got %s", state)
+	}
+	if calls := bt.convert(chfRates); calls != 0 {
+		t.Errorf("Expected the breaker to wait for a new cooldown, got %d calls", calls)
+	}
+
+	// Calls made while the probe is under way are refused; a successful probe closes it.
+	*now = now.Add(31 * time.Second)
+	probe := &blockingTransport{fragment: "/currency/CHF", next: chfRates, entered: make(chan struct{}), release: make(chan struct{})}
+	probed := make(chan int)
+	go func() { probed <- bt.convert(probe) }()
+	<-probe.entered
+	if calls := bt.convert(chfRates); calls != 0 {
+		t.Errorf("Expected a second call to be refused while probing, got %d calls", calls)
+	}
+	if state := bt.state(); state != "half-open" {
+		t.Errorf("Expected the breaker to be half-open while probing, got %s", state)
+	}
+	close(probe.release)
+	<-probed
+	if state := bt.state(); state != "closed" {
+		t.Errorf("Expected a successful probe to close the breaker, got %s", state)
+	}
+	if calls := bt.convert(chfRates); calls != 1 {
+		t.Errorf("Expected the closed breaker to let calls through, got %d calls", calls)
+	}
+}
+
+func TestOutboundRateLimit(t *testing.T) {
+	t.Setenv("UPSTREAM_RATE_LIMIT_CURRENCY", "2")
+	resetBreakers(t)
+	now := fakeClock(t)
+	bt := breakerTest{t, createKey(t, "outbound", "editor")}
+
+	// Two calls a minute; the third would wait far longer than a call may, so it is not made.
+	for i, want := range []int{1, 1, 0} {
+		if calls := bt.convert(chfRates); calls != want {
+			t.Errorf("Call %d: expected %d calls to the currency API, got %d", i+1, want, calls)
+		}
+	}
+	*now = now.Add(30 * time.Second)
+	if calls := bt.convert(chfRates); calls != 1 {
+		t.Errorf("Expected a call once the limit has refilled, got %d calls", calls)
+	}
+	if state := bt.state(); state != "closed" {
+		t.Errorf("Expected throttled calls to leave the breaker closed, got %s", state)
+	}
+}
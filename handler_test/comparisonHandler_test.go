@@ -0,0 +1,183 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nordicUpstreams answers for Sweden and Norway, with a colder capital in Norway.
+var nordicUpstreams = routeTransport{
+	{"/alpha/se", `[{"name":{"common":"Sweden"},"capital":["Stockholm"],"capitalInfo":{"latlng":[59.33,18.05]},"cca2":"SE","currencies":{"SEK":{}},"latlng":[62,15],"population":10353442,"area":450295}]`},
+	{"name/sweden", `[{"name":{"common":"Sweden"},"capital":["Stockholm"],"capitalInfo":{"latlng":[59.33,18.05]},"cca2":"SE","currencies":{"SEK":{}},"latlng":[62,15],"population":10353442,"area":450295}]`},
+	{"/alpha/no", `[{"name":{"common":"Norway"},"capital":["Oslo"],"capitalInfo":{"latlng":[59.91,10.75]},"cca2":"NO","currencies":{"NOK":{}},"latlng":[62,10],"population":5379475,"area":323802}]`},
+	{"name/norway", `[{"name":{"common":"Norway"},"capital":["Oslo"],"capitalInfo":{"latlng":[59.91,10.75]},"cca2":"NO","currencies":{"NOK":{}},"latlng":[62,10],"population":5379475,"area":323802}]`},
+	{"/currency/", `{"rates":{"EUR":1,"SEK":11.5,"NOK":11.7}}`},
+	{"latitude=59.33", `{"timezone":"Europe/Stockholm","current":{"time":"2024-03-01T12:00","temperature_2m":4.5,"precipitation":0}}`},
+	{"latitude=59.91", `{"timezone":"Europe/Oslo","current":{"time":"2024-03-01T12:00","temperature_2m":-2.0,"precipitation":0}}`},
+}
+
+func TestComparison(t *testing.T) {
+	// Stockholm is as warm in Fahrenheit, for the registration shown in imperial units.
+	useTransport(t, append(routeTransport{
+		{"fahrenheit", `{"timezone":"Europe/Stockholm","current":{"time":"2024-03-01T12:00","temperature_2m":40.1,"precipitation":0}}`},
+	}, nordicUpstreams...))
+	editor := createKey(t, "analyst", "editor")
+	viewer := createKey(t, "reader", "viewer")
+	h := handler.RequireAPIKey(handler.ComparisonHandler)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	sweden := registerID(t, editor, `{"isoCode":"se","display":{"units":"imperial","timeFormat":"unix"}}`)
+
+	if rec := do(http.MethodPost, "/dashboard/v1/comparisons/", editor, `{"isoCodes":["no"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a single country, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/dashboard/v1/comparisons/", editor, `{"registrations":["missing"],"isoCodes":["no"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown registration, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/dashboard/v1/comparisons/", editor, `{"isoCodes":["no","se"],"baseCurrency":"e1r"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a base currency that is not all letters, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/dashboard/v1/comparisons/", viewer, `{"isoCodes":["no","se"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a viewer creating a comparison, got %d", rec.Code)
+	}
+
+	rec := do(http.MethodPost, "/dashboard/v1/comparisons/", editor,
+		`{"name":"Nordics","registrations":["`+sweden+`"],"isoCodes":["no"],"features":{"population":true,"temperature":true},"baseCurrency":"eur"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var comparison handler.Comparison
+	if err := json.NewDecoder(rec.Body).Decode(&comparison); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	rec = do(http.MethodGet, "/dashboard/v1/comparisons/"+comparison.ID, editor, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	type comparisonTable struct {
+		Countries []struct {
+			ISOCode       string                 `json:"isoCode"`
+			Registration  string                 `json:"registration"`
+			Features      map[string]interface{} `json:"features"`
+			Units         string                 `json:"units"`
+			LastRetrieval string                 `json:"lastRetrieval"`
+		} `json:"countries"`
+		Rankings map[string][]struct {
+			Rank    int     `json:"rank"`
+			ISOCode string  `json:"isoCode"`
+			Value   float64 `json:"value"`
+		} `json:"rankings"`
+		Units         string `json:"units"`
+		LastRetrieval string `json:"lastRetrieval"`
+	}
+	var table comparisonTable
+	if err := json.NewDecoder(rec.Body).Decode(&table); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(table.Countries) != 2 || table.Countries[0].Registration != sweden || table.Countries[1].ISOCode != "NO" {
+		t.Fatalf("Expected Sweden's registration then Norway, got %+v", table.Countries)
+	}
+	// The registration is shown in its own units, as on its dashboard.
+	if table.Countries[0].Units != "imperial" || table.Countries[0].Features["temperature"] != 40.1 {
+		t.Errorf("Expected Stockholm's temperature 40.1 in imperial units, got %v in %s", table.Countries[0].Features["temperature"], table.Countries[0].Units)
+	}
+	if table.Countries[1].Units != "metric" || table.Countries[1].Features["temperature"] != -2.0 {
+		t.Errorf("Expected Oslo's temperature -2 in metric units, got %v in %s", table.Countries[1].Features["temperature"], table.Countries[1].Units)
+	}
+	for _, ranking := range []string{"population", "temperature", "currency"} {
+		entries := table.Rankings[ranking]
+		if len(entries) != 2 || entries[0].ISOCode != "SE" || entries[0].Rank != 1 || entries[1].ISOCode != "NO" {
+			t.Errorf("Expected Sweden ahead of Norway by %s, got %+v", ranking, entries)
+		}
+	}
+	// Rankings are in the units of the comparison.
+	if entries := table.Rankings["temperature"]; table.Units != "metric" || len(entries) != 2 || math.Abs(entries[0].Value-4.5) > 0.01 {
+		t.Errorf("Expected Stockholm ranked at 4.5 °C, got %+v in %s", entries, table.Units)
+	}
+
+	// Every timestamp of a comparison has its time format: RFC 3339 unless asked otherwise.
+	for query, layout := range map[string]string{"": time.RFC3339, "?timeFormat=legacy": "20060102 15:04"} {
+		rec := do(http.MethodGet, "/dashboard/v1/comparisons/"+comparison.ID+query, editor, "")
+		var table comparisonTable
+		if err := json.NewDecoder(rec.Body).Decode(&table); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		stamps := []string{table.LastRetrieval}
+		for _, country := range table.Countries {
+			stamps = append(stamps, country.LastRetrieval)
+		}
+		for _, stamp := range stamps {
+			if _, err := time.Parse(layout, stamp); err != nil {
+				t.Errorf("%s: expected every timestamp in %q, got %v", query, layout, stamps)
+				break
+			}
+		}
+	}
+	if rec := do(http.MethodGet, "/dashboard/v1/comparisons/"+comparison.ID+"?units=kelvin", editor, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown units, got %d", rec.Code)
+	}
+	if _, ok := table.Rankings["area"]; ok {
+		t.Errorf("Expected no area ranking when area is not selected")
+	}
+
+	if rec := do(http.MethodGet, "/dashboard/v1/comparisons/"+comparison.ID, viewer, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another key's comparison, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/dashboard/v1/comparisons/"+comparison.ID, editor, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting the comparison, got %d", rec.Code)
+	}
+}
+
+func TestComparisonCountryCodes(t *testing.T) {
+	resetBreakers(t)
+	editor := createKey(t, "codes-analyst", "editor")
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/dashboard/v1/comparisons/", strings.NewReader(body))
+		req.Header.Set(handler.APIKeyHeader, editor)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.ComparisonHandler)(rec, req)
+		return rec
+	}
+
+	useTransport(t, nordicUpstreams)
+	if rec := create(`{"isoCodes":["NO","ZZ"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown two-letter code, got %d", rec.Code)
+	}
+	if rec := create(`{"isoCodes":["NO","N0"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed code, got %d", rec.Code)
+	}
+
+	// With the countries API down, codes are looked up in the offline dataset.
+	useTransport(t, unavailableTransport{})
+	rec := create(`{"isoCodes":["NOR","752"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var comparison handler.Comparison
+	if err := json.NewDecoder(rec.Body).Decode(&comparison); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if strings.Join(comparison.ISOCodes, ",") != "NO,SE" {
+		t.Errorf("Expected the codes in two-letter form, got %v", comparison.ISOCodes)
+	}
+
+	// Without the dataset, a code that cannot be looked up is an upstream failure.
+	t.Setenv("COUNTRY_DATA", "off")
+	if rec := create(`{"isoCodes":["NO","SE"]}`); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 with the countries API down, got %d", rec.Code)
+	}
+}
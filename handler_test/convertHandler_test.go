@@ -0,0 +1,89 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	useTransport(t, routeTransport{{"/currency/NOK", `{"rates":{"EUR":0.087,"USD":0.094}}`}})
+	key := createKey(t, "convert", "viewer")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/convert"+query, nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.HandleConvert)(rec, req)
+		return rec
+	}
+
+	for query, reason := range map[string]string{
+		"?to=EUR":                        "a missing from",
+		"?from=NOK":                      "a missing to",
+		"?from=NOK&to=EUR&amount=-5":     "a negative amount",
+		"?from=NOK&to=EUR&amount=plenty": "a non-numeric amount",
+		"?from=XYZ&to=EUR":               "an unknown from",
+	} {
+		if rec := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", reason, rec.Code)
+		}
+	}
+
+	rec := get("?from=nok&to=EUR,usd,XYZ,NOK&amount=100")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result struct {
+		From        string             `json:"from"`
+		Amount      float64            `json:"amount"`
+		Conversions map[string]float64 `json:"conversions"`
+		Unknown     []string           `json:"unknown"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.From != "NOK" || result.Amount != 100 {
+		t.Errorf("Expected 100 NOK, got %v %s", result.Amount, result.From)
+	}
+	if result.Conversions["EUR"] != 8.7 || result.Conversions["USD"] != 9.4 || result.Conversions["NOK"] != 100 {
+		t.Errorf("Expected 8.7 EUR, 9.4 USD and 100 NOK, got %v", result.Conversions)
+	}
+	if len(result.Unknown) != 1 || result.Unknown[0] != "XYZ" {
+		t.Errorf("Expected XYZ to be reported unknown, got %v", result.Unknown)
+	}
+
+	// Malformed codes are refused without asking the currency API.
+	recorder := &recordingTransport{next: routeTransport{}}
+	useTransport(t, recorder)
+	for _, from := range []string{"1%24x", "n0k"} {
+		if rec := get("?from=" + from + "&to=EUR"); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for from=%s, got %d", from, rec.Code)
+		}
+	}
+	if requested := recorder.requested(); len(requested) != 0 {
+		t.Errorf("Expected no upstream calls for malformed codes, got %v", requested)
+	}
+}
+
+func TestDashboardAmount(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "amount", "editor")
+	id := registerID(t, key, `{"isoCode":"se","features":{"targetCurrencies":["EUR"]}}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/dashboards/"+id+"?amount=lots", nil)
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.HandleDashboard)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid amount, got %d", rec.Code)
+	}
+
+	dashboard := fetchDashboard(t, key, id+"?amount=1000")
+	rates := dashboard.Features["targetCurrencies"].(map[string]interface{})
+	if rates["EUR"] != 87.0 {
+		t.Errorf("Expected 1000 SEK to be 87 EUR, got %v", rates["EUR"])
+	}
+}
@@ -0,0 +1,70 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// unavailableTransport answers every upstream call with 503 Service Unavailable.
+type unavailableTransport struct{}
+
+func (unavailableTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       io.NopCloser(strings.NewReader("unavailable")),
+		Request:    r,
+	}, nil
+}
+
+func registerConfig(t *testing.T, key, body string) handler.DashboardConfig {
+	t.Helper()
+	rec := register(t, key, body)
+	var config handler.DashboardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	return config
+}
+
+func TestOfflineCountryData(t *testing.T) {
+	resetBreakers(t)
+	key := createKey(t, "offline", "editor")
+
+	// The countries API is down; registrations and dashboards fall back on the dataset.
+	useTransport(t, unavailableTransport{})
+	config := registerConfig(t, key, `{"isoCode":"is","features":{"capital":true,"area":true,"population":true,"populationDensity":true,"drivingSide":true}}`)
+	if config.Country != "Iceland" || config.ISOCode3 != "ISL" || config.Currency != "ISK" {
+		t.Errorf("Expected Iceland from the offline dataset, got %+v", config)
+	}
+	dashboard := fetchDashboard(t, key, config.ID)
+	if dashboard.Features["capital"] != "Reykjavik" || !dashboard.Sources["countries"].Offline || dashboard.Sources["countries"].Error == "" {
+		t.Errorf("Expected the capital from the offline dataset, got %v (sources %+v)", dashboard.Features["capital"], dashboard.Sources)
+	}
+	if dashboard.Features["area"] != 103000.0 {
+		t.Errorf("Expected the area from the offline dataset, got %v", dashboard.Features["area"])
+	}
+	// The dataset has no population or driving side; those are unavailable rather than zero.
+	for _, feature := range []string{"population", "populationDensity", "drivingSide"} {
+		if value, ok := dashboard.Features[feature]; !ok || value != nil || dashboard.Unavailable[feature] == "" {
+			t.Errorf("Expected %s to be unavailable offline, got %v (unavailable %v)", feature, value, dashboard.Unavailable)
+		}
+	}
+
+	// As primary source the countries API is not called at all.
+	t.Setenv("COUNTRY_DATA", "primary")
+	useTransport(t, routeTransport{})
+	if config := registerConfig(t, key, `{"country":"Norge"}`); config.ISOCode != "NO" || config.NumericCode != "578" {
+		t.Errorf("Expected Norge to resolve to Norway offline, got %+v", config)
+	}
+
+	// Turned off, an unreachable countries API leaves the registration unresolved.
+	t.Setenv("COUNTRY_DATA", "off")
+	useTransport(t, unavailableTransport{})
+	if config := registerConfig(t, key, `{"isoCode":"is"}`); config.Country != "" {
+		t.Errorf("Expected no country without the dataset, got %q", config.Country)
+	}
+}
@@ -0,0 +1,114 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// countryIndex answers the list of all countries that search matches on, and the details of
+// the United Kingdom.
+var countryIndex = routeTransport{
+	{"/v3.1/all", `[` +
+		`{"name":{"common":"Norway","official":"Kingdom of Norway","nativeName":{"nob":{"official":"Kongeriket Norge","common":"Norge"}}},"cca2":"NO","cca3":"NOR","altSpellings":["NO","Norge","Noreg"]},` +
+		`{"name":{"common":"United Kingdom","official":"United Kingdom of Great Britain and Northern Ireland"},"cca2":"GB","cca3":"GBR","altSpellings":["GB","UK","Great Britain"]},` +
+		`{"name":{"common":"Ukraine","official":"Ukraine","nativeName":{"ukr":{"official":"Україна","common":"Україна"}}},"cca2":"UA","cca3":"UKR","altSpellings":["UA","Ukrayina"]},` +
+		`{"name":{"common":"Sweden","official":"Kingdom of Sweden"},"cca2":"SE","cca3":"SWE","altSpellings":["SE","Sverige"]}]`},
+	{"/v3.1/alpha/gb", `[{"name":{"common":"United Kingdom"},"capital":["London"],"cca2":"GB","currencies":{"GBP":{}},"latlng":[54,-2]}]`},
+}
+
+type countryMatch struct {
+	Name    string `json:"name"`
+	ISOCode string `json:"isoCode"`
+	Matched string `json:"matched"`
+	Score   int    `json:"score"`
+}
+
+func searchCountries(t *testing.T, key, query string) []countryMatch {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/countries?"+query, nil)
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.HandleCountrySearch)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+	}
+	var matches []countryMatch
+	if err := json.NewDecoder(rec.Body).Decode(&matches); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	return matches
+}
+
+func TestCountrySearch(t *testing.T) {
+	useTransport(t, countryIndex)
+	key := createKey(t, "search", "viewer")
+
+	tests := []struct {
+		query, want, matched string
+	}{
+		{"q=norge", "NO", "Norge"},
+		{"q=UK", "GB", "UK"},
+		{"q=britain", "GB", "United Kingdom of Great Britain and Northern Ireland"},
+		{"q=swe", "SE", "SWE"},
+		{"q=swedn", "SE", "Sweden"},
+		{"q=%D0%A3%D0%BA%D1%80", "UA", "Україна"},
+	}
+	for _, tt := range tests {
+		matches := searchCountries(t, key, tt.query)
+		if len(matches) == 0 || matches[0].ISOCode != tt.want || matches[0].Matched != tt.matched {
+			t.Errorf("%s: expected %s matched by %q first, got %+v", tt.query, tt.want, tt.matched, matches)
+		}
+	}
+
+	// "uk" is also the start of Ukraine, but the exact alternative spelling ranks first.
+	matches := searchCountries(t, key, "q=uk&limit=2")
+	if len(matches) != 2 || matches[0].ISOCode != "GB" || matches[1].ISOCode != "UA" {
+		t.Errorf("Expected the United Kingdom then Ukraine, got %+v", matches)
+	}
+	if matches := searchCountries(t, key, "q=atlantis"); len(matches) != 0 {
+		t.Errorf("Expected no matches, got %+v", matches)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/countries?q=", nil)
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.HandleCountrySearch)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an empty query, got %d", rec.Code)
+	}
+}
+
+func TestRegistrationResolvesBySearch(t *testing.T) {
+	useTransport(t, countryIndex)
+	key := createKey(t, "resolve", "editor")
+
+	rec := register(t, key, `{"country":"Britain"}`)
+	var config handler.DashboardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if config.ISOCode != "GB" || config.Country != "United Kingdom" || config.Currency != "GBP" {
+		t.Errorf("Expected Britain to resolve to the United Kingdom, got %+v", config)
+	}
+
+	// "dom" is part of three kingdoms, so no country is picked.
+	rec = register(t, key, `{"country":"dom"}`)
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if config.ISOCode != "" || config.Country != "dom" {
+		t.Errorf("Expected an ambiguous name to stay unresolved, got %+v", config)
+	}
+
+	// Nor does a lone match inside a name, such as "tain" in Great Britain.
+	rec = register(t, key, `{"country":"tain"}`)
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if config.ISOCode != "" {
+		t.Errorf("Expected a match inside a name to stay unresolved, got %+v", config)
+	}
+}
@@ -0,0 +1,236 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// postBatch posts a batch request and returns the response.
+func postBatch(t *testing.T, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postBatchTo(t, handler.RequireAPIKey(handler.HandleDashboardBatch), "", key, body)
+}
+
+// postBatchTo posts a batch request with the given query to h and returns the response.
+func postBatchTo(t *testing.T, h http.HandlerFunc, query, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/dashboard/v1/dashboards/batch"+query, strings.NewReader(body))
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestDashboardBatch(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "batch", "editor")
+	features := `"features":{"temperature":true,"capital":true,"targetCurrencies":["EUR"]}`
+	ids := []string{
+		registerID(t, key, `{"isoCode":"se",`+features+`}`),
+		registerID(t, key, `{"isoCode":"se",`+features+`}`),
+		registerID(t, key, `{"country":"Sweden",`+features+`}`),
+	}
+
+	recorder := &recordingTransport{next: swedenUpstreams}
+	useTransport(t, recorder)
+	rec := postBatch(t, key, `{"registrations":["`+ids[0]+`","`+ids[1]+`","`+ids[2]+`","`+ids[0]+`","missing"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var batch struct {
+		Dashboards []struct {
+			populatedDashboard
+			Registration string `json:"registration"`
+			Error        string `json:"error"`
+		} `json:"dashboards"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&batch); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(batch.Dashboards) != 4 {
+		t.Fatalf("Expected the three registrations once plus the missing one, got %d dashboards", len(batch.Dashboards))
+	}
+	for i, id := range ids {
+		got := batch.Dashboards[i]
+		if got.Registration != id || got.Features["capital"] != "Stockholm" || got.Features["temperature"] != 4.5 {
+			t.Errorf("Dashboard %d: expected a populated dashboard for %s, got %+v", i, id, got)
+		}
+	}
+	if missing := batch.Dashboards[3]; missing.Registration != "missing" || missing.Error == "" {
+		t.Errorf("Expected an error for the unknown registration, got %+v", missing)
+	}
+
+	// The three dashboards share their country, rates and weather, so each is fetched once.
+	calls := map[string]int{}
+	for _, u := range recorder.requested() {
+		for _, upstream := range []string{"/v3.1/", "/currency", "forecast"} {
+			if strings.Contains(u, upstream) {
+				calls[upstream]++
+			}
+		}
+	}
+	for _, upstream := range []string{"/v3.1/", "/currency", "forecast"} {
+		if calls[upstream] != 1 {
+			t.Errorf("Expected one call to %s, got %d: %v", upstream, calls[upstream], recorder.requested())
+		}
+	}
+
+	rec = postBatch(t, key, `{"registrations":"all"}`)
+	if err := json.NewDecoder(rec.Body).Decode(&batch); err != nil || len(batch.Dashboards) != len(ids) {
+		t.Errorf("Expected every registration of the key, got %d (%v)", len(batch.Dashboards), err)
+	}
+
+	for _, body := range []string{`{"registrations":"some"}`, `{"registrations":[]}`, `{"registrations":42}`} {
+		if rec := postBatch(t, key, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+		}
+	}
+
+	// Parameters of single dashboards that a batch does not take are refused, not ignored.
+	for _, query := range []string{"?format=csv", "?fields=capital", "?amount=100"} {
+		rec := postBatchTo(t, handler.RequireAPIKey(handler.HandleDashboardBatch), query, key, `{"registrations":"all"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestDashboardBatchQuota(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "batch-quota", "editor")
+	var ids []string
+	for range 3 {
+		ids = append(ids, `"`+registerID(t, key, `{"isoCode":"se","features":{"capital":true}}`)+`"`)
+	}
+	t.Setenv("DAILY_QUOTA", "4")
+	h := handler.RateLimit("batch_quota_test", handler.RequireAPIKey(handler.HandleDashboardBatch))
+
+	// Every dashboard of a batch counts, with missing registrations free.
+	body := `{"registrations":[` + strings.Join(ids, ",") + `,"missing"]}`
+	if rec := postBatchTo(t, h, "", key, body); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for three dashboards, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := postBatchTo(t, h, "", key, `{"registrations":[`+strings.Join(ids[:2], ",")+`]}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected status 429 for two dashboards with one left of the quota, got %d", rec.Code)
+	}
+}
+
+func TestDashboardBatchPages(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "batch-pages", "editor")
+	var ids []string
+	for range 101 {
+		ids = append(ids, `"`+registerID(t, key, `{"isoCode":"se","features":{"capital":true}}`)+`"`)
+	}
+	type page struct {
+		Dashboards []struct {
+			Registration string `json:"registration"`
+		} `json:"dashboards"`
+		Next string `json:"next"`
+	}
+	fetch := func(body string) page {
+		t.Helper()
+		rec := postBatch(t, key, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var p page
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return p
+	}
+
+	// "all" is cut to the first hundred, with next pointing at the rest.
+	first := fetch(`{"registrations":"all"}`)
+	if len(first.Dashboards) != 100 || first.Next != first.Dashboards[99].Registration {
+		t.Fatalf("Expected a page of 100 dashboards ending at next, got %d with next %q", len(first.Dashboards), first.Next)
+	}
+	second := fetch(`{"registrations":"all","after":"` + first.Next + `"}`)
+	if len(second.Dashboards) != 1 || second.Next != "" || second.Dashboards[0].Registration <= first.Next {
+		t.Errorf("Expected the last dashboard without next, got %+v", second)
+	}
+
+	// A list of IDs is never cut short.
+	if rec := postBatch(t, key, `{"registrations":[`+strings.Join(ids, ",")+`]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for 101 listed IDs, got %d", rec.Code)
+	}
+	if rec := postBatch(t, key, `{"registrations":[`+ids[0]+`],"after":"x"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for after with listed IDs, got %d", rec.Code)
+	}
+}
+
+// concurrencyTransport counts the calls matching fragment and the most of them under way at once.
+type concurrencyTransport struct {
+	fragment string
+	next     http.RoundTripper
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	calls    int
+}
+
+func (ct *concurrencyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.Contains(r.URL.String(), ct.fragment) {
+		return ct.next.RoundTrip(r)
+	}
+	ct.mu.Lock()
+	ct.inFlight++
+	ct.peak = max(ct.peak, ct.inFlight)
+	ct.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	ct.mu.Lock()
+	ct.inFlight--
+	ct.calls++
+	ct.mu.Unlock()
+	return ct.next.RoundTrip(r)
+}
+
+func TestDashboardBatchWebhooks(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	t.Setenv("BATCH_WORKERS", "2")
+	key := createKey(t, "batch-hooks", "editor")
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/dashboard/v1/notifications/", strings.NewReader(`{"url":"http://hooks.example/invoke","event":"INVOKE"}`))
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.NotificationHandler)(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 creating a webhook, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	for range 5 {
+		registerID(t, key, `{"isoCode":"se","features":{"capital":true}}`)
+	}
+
+	hooks := &concurrencyTransport{fragment: "hooks.example", next: append(routeTransport{{"hooks.example", `{}`}}, swedenUpstreams...)}
+	useTransport(t, hooks)
+	if rec := postBatch(t, key, `{"registrations":"all"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Ten deliveries, two webhooks for each of five dashboards, no more than two at a time.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hooks.mu.Lock()
+		calls, peak := hooks.calls, hooks.peak
+		hooks.mu.Unlock()
+		if calls == 10 {
+			if peak > 2 {
+				t.Errorf("Expected at most 2 deliveries at once, got %d", peak)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 10 deliveries, got %d", calls)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,699 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// swedenUpstreams answers every upstream API the dashboard uses.
+var swedenUpstreams = routeTransport{
+	{"/v3.1/", `[{"name":{"common":"Sweden"},"capital":["Stockholm"],"capitalInfo":{"latlng":[59.33,18.05]},"cca2":"SE","currencies":{"SEK":{}},"latlng":[62,15],"population":10353442,"area":450295}]`},
+	{"/currency", `{"rates":{"EUR":0.087}}`},
+	{"geocoding", `{"results":[{"latitude":59.33,"longitude":18.07,"name":"Stockholm"}]}`},
+	{"forecast", `{"timezone":"Europe/Stockholm",` +
+		`"current":{"time":"2024-03-01T12:00","temperature_2m":4.5,"precipitation":0.2,"wind_speed_10m":12.5,` +
+		`"wind_direction_10m":250,"relative_humidity_2m":81,"cloud_cover":75,"uv_index":1.2},` +
+		`"current_units":{"wind_speed_10m":"km/h","wind_direction_10m":"°","relative_humidity_2m":"%","cloud_cover":"%","uv_index":""},` +
+		`"hourly":{"time":["2024-03-01T00:00","2024-03-01T01:00"],"temperature_2m":[1.0,1.5],"precipitation":[0,0.1]},` +
+		`"daily":{"time":["2024-03-01","2024-03-02"],"temperature_2m_min":[-1.0,0.5],"temperature_2m_max":[6.0,7.5],` +
+		`"temperature_2m_mean":[2.5,4.0],"precipitation_sum":[0.4,1.2],` +
+		`"sunrise":["2024-03-01T06:58","2024-03-02T06:55"],"sunset":["2024-03-01T17:36","2024-03-02T17:39"]}}`},
+	{"air-quality", `{"current":{"time":"2024-03-01T12:00","european_aqi":21,"us_aqi":30,"pm10":9.1,"pm2_5":5.3},` +
+		`"current_units":{"european_aqi":"EAQI","us_aqi":"USAQI","pm10":"μg/m³","pm2_5":"μg/m³"}}`},
+}
+
+type populatedDashboard struct {
+	Features map[string]interface{} `json:"features"`
+	Sources  map[string]struct {
+		Stale   bool   `json:"stale"`
+		Age     int    `json:"age"`
+		Error   string `json:"error"`
+		Offline bool   `json:"offline"`
+	} `json:"sources"`
+	Unavailable   map[string]string `json:"unavailable"`
+	Units         string            `json:"units"`
+	LastRetrieval string            `json:"lastRetrieval"`
+	Location      dashboardLocation `json:"location"`
+	Locations     []struct {
+		Name        string                 `json:"name"`
+		Location    dashboardLocation      `json:"location"`
+		Features    map[string]interface{} `json:"features"`
+		Unavailable map[string]string      `json:"unavailable"`
+	} `json:"locations"`
+}
+
+type dashboardLocation struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Source    string  `json:"source"`
+}
+
+// register posts a registration with the given API key.
+func register(t *testing.T, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/dashboard/v1/registrations/", strings.NewReader(body))
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.RegistrationHandler)(rec, req)
+	return rec
+}
+
+// registerID posts a registration that must succeed and returns its ID.
+func registerID(t *testing.T, key, body string) string {
+	t.Helper()
+	rec := register(t, key, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var config handler.DashboardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	return config.ID
+}
+
+// fetchDashboard gets the populated dashboard for a registration.
+func fetchDashboard(t *testing.T, key, id string) populatedDashboard {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/dashboards/"+id, nil)
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.HandleDashboard)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var dashboard populatedDashboard
+	if err := json.NewDecoder(rec.Body).Decode(&dashboard); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	return dashboard
+}
+
+func TestDashboardServesStaleData(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "stale", "editor")
+
+	id := registerID(t, key, `{"isoCode":"se","features":{"temperature":true,"capital":true,"targetCurrencies":["EUR","XYZ"]}}`)
+
+	fresh := fetchDashboard(t, key, id)
+	if fresh.Features["capital"] != "Stockholm" || fresh.Sources["countries"].Stale {
+		t.Errorf("Expected fresh capital 'Stockholm', got %v (sources %+v)", fresh.Features["capital"], fresh.Sources)
+	}
+	rates := fresh.Features["targetCurrencies"].(map[string]interface{})
+	if rates["EUR"] != 0.087 || rates["XYZ"] != nil {
+		t.Errorf("Expected EUR rate 0.087 and XYZ null, got %v", rates)
+	}
+	if fresh.Unavailable["targetCurrencies.XYZ"] == "" {
+		t.Errorf("Expected a reason for the missing XYZ rate")
+	}
+
+	// Every upstream now fails; the last known good values are served and marked stale.
+	useTransport(t, routeTransport{})
+	stale := fetchDashboard(t, key, id)
+	if stale.Features["capital"] != "Stockholm" {
+		t.Errorf("Expected stale capital 'Stockholm', got %v", stale.Features["capital"])
+	}
+	for _, source := range []string{"countries", "currency", "weather"} {
+		if !stale.Sources[source].Stale || stale.Sources[source].Error == "" {
+			t.Errorf("Expected source %s to be stale with an error, got %+v", source, stale.Sources[source])
+		}
+	}
+}
+
+func TestDashboardStaleForecast(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "stale-forecast", "editor")
+	location := `"location":{"name":"Umeå","latitude":63.83,"longitude":20.26}`
+	daily := registerID(t, key, `{"isoCode":"se",`+location+`,"features":{"forecast":{"days":2}}}`)
+	hourly := registerID(t, key, `{"isoCode":"se",`+location+`,"features":{"forecast":{"days":2,"resolution":"hourly"}}}`)
+	longer := registerID(t, key, `{"isoCode":"se",`+location+`,"features":{"forecast":{"days":3}}}`)
+	fetchDashboard(t, key, daily)
+
+	// A fallback is only served for the same forecast it was fetched for.
+	useTransport(t, routeTransport{})
+	if got := fetchDashboard(t, key, daily); !got.Sources["weather"].Stale || got.Features["forecast"] == nil {
+		t.Errorf("Expected the stale daily forecast, got %v (sources %+v)", got.Features["forecast"], got.Sources)
+	}
+	for name, id := range map[string]string{"hourly": hourly, "longer": longer} {
+		if got := fetchDashboard(t, key, id); got.Sources["weather"].Stale || got.Features["forecast"] != nil {
+			t.Errorf("%s: expected no forecast, got %v (sources %+v)", name, got.Features["forecast"], got.Sources)
+		}
+	}
+}
+
+func TestDashboardWeatherFeatures(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "weather", "editor")
+
+	if rec := register(t, key, `{"isoCode":"se","features":{"forecast":{"days":17}}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for 17 forecast days, got %d", rec.Code)
+	}
+	if rec := register(t, key, `{"isoCode":"se","features":{"forecast":{"days":1,"resolution":"weekly"}}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown resolution, got %d", rec.Code)
+	}
+
+	id := registerID(t, key, `{"isoCode":"se","features":{"temperature":true,"current":true,"today":true,"forecast":{"days":2},`+
+		`"wind":true,"humidity":true,"sun":true,"airQuality":true}}`)
+	dashboard := fetchDashboard(t, key, id)
+
+	if dashboard.Location.Source != "capital" || dashboard.Location.Name != "Stockholm" || dashboard.Location.Latitude != 59.33 {
+		t.Errorf("Expected the weather to be taken at the capital, got %+v", dashboard.Location)
+	}
+	if dashboard.Features["temperature"] != 4.5 {
+		t.Errorf("Expected current temperature 4.5, got %v", dashboard.Features["temperature"])
+	}
+	current := dashboard.Features["current"].(map[string]interface{})
+	if current["time"] != "2024-03-01T12:00" || current["timezone"] != "Europe/Stockholm" {
+		t.Errorf("Expected local time and timezone, got %v", current)
+	}
+	today := dashboard.Features["today"].(map[string]interface{})
+	if today["min"] != -1.0 || today["max"] != 6.0 || today["precipitationSum"] != 0.4 {
+		t.Errorf("Expected today's aggregates, got %v", today)
+	}
+	forecast := dashboard.Features["forecast"].(map[string]interface{})
+	if forecast["resolution"] != "daily" || len(forecast["series"].([]interface{})) != 2 {
+		t.Errorf("Expected a two day daily forecast, got %v", forecast)
+	}
+	wind := dashboard.Features["wind"].(map[string]interface{})
+	if speed := wind["speed"].(map[string]interface{}); speed["value"] != 12.5 || speed["unit"] != "km/h" {
+		t.Errorf("Expected wind speed 12.5 km/h, got %v", speed)
+	}
+	if humidity := dashboard.Features["humidity"].(map[string]interface{}); humidity["value"] != 81.0 || humidity["unit"] != "%" {
+		t.Errorf("Expected humidity 81 %%, got %v", humidity)
+	}
+	if sun := dashboard.Features["sun"].(map[string]interface{}); sun["sunrise"] != "2024-03-01T06:58" || sun["sunset"] != "2024-03-01T17:36" {
+		t.Errorf("Expected today's sunrise and sunset, got %v", sun)
+	}
+	air := dashboard.Features["airQuality"].(map[string]interface{})
+	if pm := air["pm2_5"].(map[string]interface{}); pm["value"] != 5.3 || pm["unit"] != "μg/m³" {
+		t.Errorf("Expected PM2.5 of 5.3 μg/m³, got %v", pm)
+	}
+	if _, ok := dashboard.Features["uvIndex"]; ok {
+		t.Errorf("Expected uvIndex to be left out when not enabled")
+	}
+}
+
+// recordingTransport remembers the URLs it was asked for before passing them on.
+type recordingTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	urls []string
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.urls = append(rt.urls, r.URL.String())
+	rt.mu.Unlock()
+	return rt.next.RoundTrip(r)
+}
+
+func (rt *recordingTransport) requested() []string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return append([]string(nil), rt.urls...)
+}
+
+func TestDashboardWeatherLocation(t *testing.T) {
+	recorder := &recordingTransport{next: swedenUpstreams}
+	useTransport(t, recorder)
+	key := createKey(t, "location", "editor")
+
+	if rec := register(t, key, `{"isoCode":"se","location":{"latitude":59.3}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a latitude without longitude, got %d", rec.Code)
+	}
+
+	got := fetchDashboard(t, key, registerID(t, key, `{"isoCode":"se","location":{"city":"Stockholm"},"features":{"temperature":true}}`))
+	if got.Location.Source != "city" || got.Location.Longitude != 18.07 {
+		t.Errorf("Expected the geocoded city, got %+v", got.Location)
+	}
+	geocoded := false
+	for _, u := range recorder.requested() {
+		if strings.Contains(u, "geocoding") && strings.Contains(u, "countryCode=SE") {
+			geocoded = true
+		}
+	}
+	if !geocoded {
+		t.Errorf("Expected the city to be geocoded within Sweden, got requests %v", recorder.requested())
+	}
+
+	got = fetchDashboard(t, key, registerID(t, key,
+		`{"isoCode":"se","location":{"city":"Kiruna","latitude":67.85,"longitude":20.23},"features":{"temperature":true}}`))
+	if got.Location.Source != "coordinates" || got.Location.Name != "Kiruna" || got.Location.Latitude != 67.85 {
+		t.Errorf("Expected the registered coordinates, got %+v", got.Location)
+	}
+}
+
+func TestDashboardMultipleLocations(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "locations", "editor")
+
+	if rec := register(t, key, `{"isoCode":"se","locations":[{"city":"Lund"},{"name":"lund","latitude":55.7,"longitude":13.2}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for duplicate location names, got %d", rec.Code)
+	}
+	if rec := register(t, key, `{"isoCode":"se","locations":[{"name":"Nowhere"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a location without city or coordinates, got %d", rec.Code)
+	}
+
+	id := registerID(t, key, `{"isoCode":"se","features":{"temperature":true,"capital":true},"locations":[`+
+		`{"name":"Home","city":"Stockholm"},{"name":"Cabin","latitude":67.85,"longitude":20.23}]}`)
+	dashboard := fetchDashboard(t, key, id)
+
+	if dashboard.Features["capital"] != "Stockholm" || dashboard.Location.Source != "capital" {
+		t.Errorf("Expected the country features and capital weather to stay, got %v at %+v", dashboard.Features, dashboard.Location)
+	}
+	if len(dashboard.Locations) != 2 {
+		t.Fatalf("Expected 2 locations, got %d", len(dashboard.Locations))
+	}
+	home, cabin := dashboard.Locations[0], dashboard.Locations[1]
+	if home.Name != "Home" || home.Location.Source != "city" || home.Features["temperature"] != 4.5 {
+		t.Errorf("Expected Home with geocoded weather, got %+v", home)
+	}
+	if cabin.Name != "Cabin" || cabin.Location.Source != "coordinates" || cabin.Features["capital"] != nil {
+		t.Errorf("Expected Cabin with only weather features, got %+v", cabin)
+	}
+}
+
+func TestRegistrationMultipleCurrencies(t *testing.T) {
+	useTransport(t, routeTransport{
+		{"/v3.1/", `[{"name":{"common":"Panama"},"capital":["Panama City"],"cca2":"PA","currencies":{"PAB":{},"USD":{}},"latlng":[9,-80]}]`},
+		{"/currency/PAB", `{"rates":{"USD":1,"EUR":0.92}}`},
+		{"/currency/USD", `{"rates":{"PAB":1,"EUR":0.92}}`},
+	})
+	key := createKey(t, "currencies", "editor")
+
+	rec := register(t, key, `{"isoCode":"pa","features":{"targetCurrencies":["EUR","USD"],"allCurrencies":true}}`)
+	var config handler.DashboardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if config.Currency != "PAB" || strings.Join(config.Currencies, ",") != "PAB,USD" {
+		t.Errorf("Expected primary PAB of PAB,USD, got %q of %v", config.Currency, config.Currencies)
+	}
+
+	rec = register(t, key, `{"isoCode":"pa","currency":"usd"}`)
+	var overridden handler.DashboardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&overridden); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if overridden.Currency != "USD" || len(overridden.Currencies) != 2 {
+		t.Errorf("Expected the USD override with both currencies kept, got %q of %v", overridden.Currency, overridden.Currencies)
+	}
+	if rec := register(t, key, `{"isoCode":"pa","currency":"dollar"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a currency that is not a three-letter code, got %d", rec.Code)
+	}
+
+	// Updating the country keeps the override, unless the update sets the currency itself.
+	update := func(body string) string {
+		req := httptest.NewRequest(http.MethodPut, "/dashboard/v1/registrations/"+overridden.ID, strings.NewReader(body))
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.RegistrationHandler)(rec, req)
+		if rec.Code != http.StatusNoContent {
+			return fmt.Sprintf("status %d", rec.Code)
+		}
+		req = httptest.NewRequest(http.MethodGet, "/dashboard/v1/registrations/"+overridden.ID, nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec = httptest.NewRecorder()
+		handler.RequireAPIKey(handler.RegistrationHandler)(rec, req)
+		var updated handler.DashboardConfig
+		if err := json.NewDecoder(rec.Body).Decode(&updated); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return updated.Currency
+	}
+	if got := update(`{"isoCode":"pa"}`); got != "USD" {
+		t.Errorf("Expected the USD override to survive an ISO update, got %s", got)
+	}
+	if got := update(`{"currency":"us"}`); got != "status 400" {
+		t.Errorf("Expected status 400 for a two-letter currency, got %s", got)
+	}
+	if got := update(`{"isoCode":"pa","currency":"pab"}`); got != "PAB" {
+		t.Errorf("Expected the currency of the update to win, got %s", got)
+	}
+
+	dashboard := fetchDashboard(t, key, config.ID)
+	perCurrency, ok := dashboard.Features["currencies"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected currencies feature, got %v", dashboard.Features["currencies"])
+	}
+	pab, _ := perCurrency["PAB"].(map[string]interface{})
+	usd, _ := perCurrency["USD"].(map[string]interface{})
+	if pab["EUR"] != 0.92 || pab["USD"] != 1.0 || usd["EUR"] != 0.92 || usd["USD"] != 1.0 {
+		t.Errorf("Expected rates against both PAB and USD, got %v", perCurrency)
+	}
+}
+
+// blockingTransport holds upstream calls for URLs containing fragment until release is closed,
+// closing entered when the first one arrives.
+type blockingTransport struct {
+	fragment string
+	next     http.RoundTripper
+	once     sync.Once
+	entered  chan struct{}
+	release  chan struct{}
+}
+
+func (bt *blockingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.Contains(r.URL.String(), bt.fragment) {
+		bt.once.Do(func() { close(bt.entered) })
+		<-bt.release
+	}
+	return bt.next.RoundTrip(r)
+}
+
+func TestRegistrationUpdateDoesNotBlock(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "slow-update", "editor")
+	id := registerID(t, key, `{"isoCode":"se"}`)
+
+	slow := &blockingTransport{
+		fragment: "/alpha/lv",
+		next:     routeTransport{{"/alpha/lv", `[{"name":{"common":"Latvia"},"cca2":"LV","currencies":{"EUR":{}}}]`}},
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	useTransport(t, slow)
+	updated := make(chan int)
+	go func() {
+		req := httptest.NewRequest(http.MethodPut, "/dashboard/v1/registrations/"+id, strings.NewReader(`{"isoCode":"lv"}`))
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.RegistrationHandler)(rec, req)
+		updated <- rec.Code
+	}()
+	<-slow.entered
+
+	// Other requests are served while the update waits for the countries API.
+	listed := make(chan int)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/registrations/", nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.RegistrationHandler)(rec, req)
+		listed <- rec.Code
+	}()
+	select {
+	case code := <-listed:
+		if code != http.StatusOK {
+			t.Errorf("Expected status 200 listing registrations, got %d", code)
+		}
+		close(slow.release)
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected the list to be served during a country lookup")
+		close(slow.release)
+		<-listed
+	}
+	if code := <-updated; code != http.StatusNoContent {
+		t.Errorf("Expected status 204 for the update, got %d", code)
+	}
+}
+
+func TestDashboardCountryFacts(t *testing.T) {
+	useTransport(t, routeTransport{
+		{"fullText", `[{"name":{"common":"Norway"},"capital":["Oslo"],"cca2":"NO","currencies":{"NOK":{}},"latlng":[62,10],` +
+			`"population":5379475,"area":323802,"languages":{"nno":"Norwegian Nynorsk","nob":"Norwegian Bokmål","smi":"Sami"},` +
+			`"borders":["FIN","SWE","RUS"],"region":"Europe","subregion":"Northern Europe","timezones":["UTC+01:00"],` +
+			`"idd":{"root":"+4","suffixes":["7"]},"flags":{"png":"https://flagcdn.com/w320/no.png","svg":"https://flagcdn.com/no.svg"},` +
+			`"flag":"🇳🇴","car":{"side":"right"}}]`},
+		{"codes=", `[{"name":{"common":"Finland"},"cca3":"FIN"},{"name":{"common":"Sweden"},"cca3":"SWE"}]`},
+	})
+	key := createKey(t, "facts", "editor")
+	id := registerID(t, key, `{"isoCode":"no","features":{"languages":true,"borders":true,"region":true,"timezones":true,`+
+		`"callingCodes":true,"flag":true,"drivingSide":true,"populationDensity":true}}`)
+
+	dashboard := fetchDashboard(t, key, id)
+	if len(dashboard.Unavailable) != 0 {
+		t.Fatalf("Expected every fact, got unavailable %v", dashboard.Unavailable)
+	}
+	languages, _ := json.Marshal(dashboard.Features["languages"])
+	if string(languages) != `["Norwegian Bokmål","Norwegian Nynorsk","Sami"]` {
+		t.Errorf("Expected sorted language names, got %s", languages)
+	}
+	borders, _ := json.Marshal(dashboard.Features["borders"])
+	if string(borders) != `[{"code":"FIN","name":"Finland"},{"code":"SWE","name":"Sweden"},{"code":"RUS","name":"RUS"}]` {
+		t.Errorf("Expected resolved border names, got %s", borders)
+	}
+	region := dashboard.Features["region"].(map[string]interface{})
+	if region["region"] != "Europe" || region["subregion"] != "Northern Europe" {
+		t.Errorf("Expected Europe/Northern Europe, got %v", region)
+	}
+	codes, _ := json.Marshal(dashboard.Features["callingCodes"])
+	if string(codes) != `["+47"]` {
+		t.Errorf("Expected +47, got %s", codes)
+	}
+	flag := dashboard.Features["flag"].(map[string]interface{})
+	if flag["emoji"] != "🇳🇴" || flag["svg"] != "https://flagcdn.com/no.svg" {
+		t.Errorf("Expected the Norwegian flag, got %v", flag)
+	}
+	if dashboard.Features["drivingSide"] != "right" {
+		t.Errorf("Expected right-hand traffic, got %v", dashboard.Features["drivingSide"])
+	}
+	if dashboard.Features["populationDensity"] != 16.61 {
+		t.Errorf("Expected 16.61 people per km², got %v", dashboard.Features["populationDensity"])
+	}
+}
+
+func TestRegistrationCountryCodes(t *testing.T) {
+	norway := `[{"name":{"common":"Norway"},"capital":["Oslo"],"cca2":"NO","cca3":"NOR","ccn3":"578","currencies":{"NOK":{}},"latlng":[62,10]}]`
+	useTransport(t, routeTransport{{"alpha/no?", norway}, {"alpha/nor?", norway}, {"alpha/578?", norway}, {"name/norway?", norway}})
+	key := createKey(t, "codes", "editor")
+
+	for _, body := range []string{`{"isoCode":"NOR"}`, `{"isoCode":"578"}`, `{"country":"nor"}`} {
+		rec := register(t, key, body)
+		var config handler.DashboardConfig
+		if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		if config.Country != "Norway" || config.ISOCode != "NO" || config.ISOCode3 != "NOR" || config.NumericCode != "578" {
+			t.Errorf("%s: expected Norway as NO/NOR/578, got %+v", body, config)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/dashboard/v1/notifications/", strings.NewReader(`{"url":"http://example.com/hook","country":"nor","event":"INVOKE"}`))
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.NotificationHandler)(rec, req)
+	var webhook handler.Webhook
+	if err := json.NewDecoder(rec.Body).Decode(&webhook); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if webhook.Country != "NO" {
+		t.Errorf("Expected the webhook country stored as NO, got %q", webhook.Country)
+	}
+}
+
+func TestDashboardFields(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "fields", "editor")
+	id := registerID(t, key, `{"isoCode":"se","features":{"temperature":true,"capital":true,"targetCurrencies":["EUR"]}}`)
+
+	dashboard := fetchDashboard(t, key, id+"?fields=capital,population")
+	if len(dashboard.Features) != 2 || dashboard.Features["capital"] != "Stockholm" || dashboard.Features["population"] != 10353442.0 {
+		t.Errorf("Expected only capital and population, got %v", dashboard.Features)
+	}
+	if _, ok := dashboard.Sources["weather"]; ok {
+		t.Errorf("Expected no weather source when temperature is not selected, got %+v", dashboard.Sources)
+	}
+
+	// Currency features bring the registration's target currencies along without showing them.
+	dashboard = fetchDashboard(t, key, id+"?fields=currencyChange")
+	if _, ok := dashboard.Features["currencyChange"].(map[string]interface{})["EUR"]; !ok || len(dashboard.Features) != 1 {
+		t.Errorf("Expected only the EUR currency change, got %v", dashboard.Features)
+	}
+
+	// Every feature a registration can have can be selected.
+	raw, err := json.Marshal(handler.Features{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names map[string]interface{}
+	if err := json.Unmarshal(raw, &names); err != nil {
+		t.Fatal(err)
+	}
+	for name := range names {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/dashboards/"+id+"?fields="+name, nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.HandleDashboard)(rec, req)
+		if rec.Code == http.StatusBadRequest {
+			t.Errorf("fields=%s: expected the feature to be selectable, got %s", name, rec.Body.String())
+		}
+	}
+
+	for _, fields := range []string{"capital,bogus", ",", "currencyChange"} {
+		target := id
+		if fields == "currencyChange" {
+			// Not possible without target currencies on the registration.
+			target = registerID(t, key, `{"isoCode":"se"}`)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/dashboards/"+target+"?fields="+fields, nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.HandleDashboard)(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("fields=%s: expected status 400, got %d", fields, rec.Code)
+		}
+	}
+
+	// The stored registration is not changed by a selection.
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/registrations/"+id, nil)
+	req.Header.Set(handler.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(handler.RegistrationHandler)(rec, req)
+	var config handler.DashboardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if config.Features.Population || !config.Features.Temperature {
+		t.Errorf("Expected the stored features unchanged, got %+v", config.Features)
+	}
+}
+
+func TestDashboardDisplay(t *testing.T) {
+	recorder := &recordingTransport{next: swedenUpstreams}
+	useTransport(t, recorder)
+	key := createKey(t, "display", "editor")
+
+	if rec := register(t, key, `{"isoCode":"se","display":{"units":"kelvin"}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown units, got %d", rec.Code)
+	}
+	id := registerID(t, key, `{"isoCode":"se","features":{"temperature":true,"area":true,"populationDensity":true},`+
+		`"display":{"units":"Imperial","timezone":"Asia/Tokyo","timeFormat":"legacy","decimals":1}}`)
+
+	dashboard := fetchDashboard(t, key, id)
+	if dashboard.Units != "imperial" || dashboard.Features["area"] != 173859.8 {
+		t.Errorf("Expected the area in square miles to one decimal, got %v %v", dashboard.Units, dashboard.Features["area"])
+	}
+	// Density stays people per km², as documented, in imperial units too.
+	if density := dashboard.Features["populationDensity"]; density != 23.0 {
+		t.Errorf("Expected 23 people per km², got %v", density)
+	}
+	if _, err := time.Parse("20060102 15:04", dashboard.LastRetrieval); err != nil {
+		t.Errorf("Expected a legacy timestamp, got %q", dashboard.LastRetrieval)
+	}
+	fahrenheit := false
+	for _, u := range recorder.requested() {
+		if strings.Contains(u, "forecast") && strings.Contains(u, "temperature_unit=fahrenheit") {
+			fahrenheit = true
+		}
+	}
+	if !fahrenheit {
+		t.Errorf("Expected the weather in imperial units, got requests %v", recorder.requested())
+	}
+
+	// Request parameters override the registration for one request.
+	dashboard = fetchDashboard(t, key, id+"?units=metric&timeFormat=rfc3339")
+	if dashboard.Units != "metric" || dashboard.Features["area"] != 450295.0 {
+		t.Errorf("Expected the area in square kilometres, got %v %v", dashboard.Units, dashboard.Features["area"])
+	}
+	if _, err := time.Parse(time.RFC3339, dashboard.LastRetrieval); err != nil || !strings.HasSuffix(dashboard.LastRetrieval, "+09:00") {
+		t.Errorf("Expected an RFC 3339 timestamp in Tokyo time, got %q", dashboard.LastRetrieval)
+	}
+
+	for _, query := range []string{"timezone=Mars/Olympus", "decimals=11", "timeFormat=iso"} {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard/v1/dashboards/"+id+"?"+query, nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.HandleDashboard)(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+// fetchFormatted gets url with the given Accept header and returns the response.
+func fetchFormatted(t *testing.T, key, url, accept string, h http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set(handler.APIKeyHeader, key)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	handler.RequireAPIKey(h)(rec, req)
+	return rec
+}
+
+func TestDashboardFormats(t *testing.T) {
+	useTransport(t, swedenUpstreams)
+	key := createKey(t, "formats", "editor")
+	id := registerID(t, key, `{"isoCode":"se","features":{"capital":true,"languages":true,"wind":true}}`)
+	dashboardURL := "/dashboard/v1/dashboards/" + id
+
+	rec := fetchFormatted(t, key, dashboardURL+"?format=csv", "application/json", handler.HandleDashboard)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected CSV, got %q: %s", ct, rec.Body.String())
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	rows := map[string]string{}
+	for _, record := range records {
+		rows[record[0]] = record[1]
+	}
+	if rows["features.capital"] != "Stockholm" || rows["features.wind.speed.value"] != "12.5" || rows["isoCode"] != "SE" {
+		t.Errorf("Expected flattened features, got %v", rows)
+	}
+
+	// The highest quality type we serve wins.
+	rec = fetchFormatted(t, key, dashboardURL, "image/png, text/csv;q=0.5, application/xml", handler.HandleDashboard)
+	var doc struct {
+		XMLName  xml.Name `xml:"dashboard"`
+		ISOCode  string   `xml:"isoCode"`
+		Features struct {
+			Capital string `xml:"capital"`
+		} `xml:"features"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse XML: %v\n%s", err, rec.Body.String())
+	}
+	if doc.ISOCode != "SE" || doc.Features.Capital != "Stockholm" {
+		t.Errorf("Expected the dashboard as XML, got %+v", doc)
+	}
+
+	rec = fetchFormatted(t, key, dashboardURL, "text/markdown", handler.HandleDashboard)
+	if body := rec.Body.String(); !strings.HasPrefix(body, "# Sweden (SE)") || !strings.Contains(body, "| capital | Stockholm |") {
+		t.Errorf("Expected a Markdown summary, got %s", body)
+	}
+
+	// JSON is served unless another format is the first choice, which it is not for a browser.
+	for _, accept := range []string{
+		"image/png",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"application/xml;q=0.5, application/json;q=0.5",
+		"text/csv;q=0.8, */*;q=0.8",
+	} {
+		rec := fetchFormatted(t, key, dashboardURL, accept, handler.HandleDashboard)
+		if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || ct != "application/json" {
+			t.Errorf("Accept %q: expected JSON, got %d %q", accept, rec.Code, ct)
+		}
+	}
+	rec = fetchFormatted(t, key, dashboardURL, "text/csv, */*;q=0.8", handler.HandleDashboard)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Expected CSV when preferred over */*, got %q", ct)
+	}
+	if rec := fetchFormatted(t, key, dashboardURL+"?format=pdf", "", handler.HandleDashboard); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", rec.Code)
+	}
+
+	rec = fetchFormatted(t, key, "/dashboard/v1/registrations/?format=csv", "", handler.RegistrationHandler)
+	records, err = csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(records) != 2 || records[0][0] != "id" || records[1][0] != id {
+		t.Errorf("Expected one registration row under a header, got %v (%v)", records, err)
+	}
+	rec = fetchFormatted(t, key, "/dashboard/v1/registrations/", "text/markdown", handler.RegistrationHandler)
+	if !strings.Contains(rec.Body.String(), "| "+id+" | Sweden | SE | SEK | capital, languages, wind |") {
+		t.Errorf("Expected a Markdown table of registrations, got %s", rec.Body.String())
+	}
+}
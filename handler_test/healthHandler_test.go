@@ -0,0 +1,100 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleHealthz))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadyzHandlerWithoutStorage(t *testing.T) {
+	// A cache file that cannot be loaded must leave the service not ready.
+	writeCacheFile(t, "{")
+	if err := handler.LoadCache(); err == nil {
+		t.Fatal("Expected an error for a corrupt cache file")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleReadyz))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", resp.StatusCode)
+	}
+	var result struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.Checks["storage"] != "not loaded" {
+		t.Errorf("Expected storage check 'not loaded', got '%v'", result.Checks["storage"])
+	}
+}
+
+func TestReadyzHandlerFirstStart(t *testing.T) {
+	// On a first deploy there is no cache file yet, which is an empty store, not a failure.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	readyz := func() map[string]string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var result struct {
+			Checks map[string]string `json:"checks"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return result.Checks
+	}
+	if err := handler.LoadCache(); err != nil {
+		t.Fatalf("Expected a missing cache file to load as empty, got %v", err)
+	}
+	if checks := readyz(); checks["storage"] != "ok" {
+		t.Errorf("Expected storage check 'ok' without a cache file, got '%v'", checks["storage"])
+	}
+
+	// A file that does not parse leaves the storage not loaded.
+	if err := os.MkdirAll("stored-data", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("stored-data/cache.json", []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.LoadCache(); err == nil {
+		t.Error("Expected an error for a corrupt cache file")
+	}
+	if checks := readyz(); checks["storage"] != "not loaded" {
+		t.Errorf("Expected storage check 'not loaded' after a failed load, got '%v'", checks["storage"])
+	}
+}
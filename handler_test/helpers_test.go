@@ -0,0 +1,81 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// stubTransport answers every upstream call with the same canned JSON body.
+type stubTransport string
+
+func (s stubTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(s))),
+		Request:    r,
+	}, nil
+}
+
+// route is a canned upstream answer: body, for URLs that contain fragment.
+type route struct {
+	fragment string
+	body     string
+}
+
+// routeTransport answers upstream calls with the body of the first route whose fragment is part
+// of the URL, and with 404 Not Found when no route matches.
+type routeTransport []route
+
+func (rt routeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for _, route := range rt {
+		if strings.Contains(r.URL.String(), route.fragment) {
+			return stubTransport(route.body).RoundTrip(r)
+		}
+	}
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(strings.NewReader("not found")),
+		Request:    r,
+	}, nil
+}
+
+// useTransport routes handler.HttpClient through rt for the rest of the test.
+func useTransport(t *testing.T, rt http.RoundTripper) {
+	t.Helper()
+	old := handler.HttpClient
+	handler.HttpClient = &http.Client{Transport: rt}
+	t.Cleanup(func() { handler.HttpClient = old })
+}
+
+// writeCacheFile switches to an empty directory for the rest of the test and stores data as its
+// cache file, ready for handler.LoadCache.
+func writeCacheFile(t *testing.T, data string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.MkdirAll("stored-data", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("stored-data/cache.json", []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// resetBreakers closes every upstream circuit breaker now and again after the test, so a test
+// neither inherits open breakers nor leaves them behind.
+func resetBreakers(t *testing.T) {
+	t.Helper()
+	handler.ResetUpstreamGuards()
+	t.Cleanup(handler.ResetUpstreamGuards)
+}
@@ -0,0 +1,37 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	var seen string
+	h := handler.WithRequestLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = handler.RequestID(r.Context())
+	}))
+
+	// An incoming request ID is kept and echoed back.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(handler.RequestIDHeader, "abc123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if seen != "abc123" {
+		t.Errorf("Expected request ID 'abc123' in context, got '%v'", seen)
+	}
+	if got := rec.Header().Get(handler.RequestIDHeader); got != "abc123" {
+		t.Errorf("Expected response header 'abc123', got '%v'", got)
+	}
+
+	// Without one, a new ID is generated.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if seen == "" || seen == "abc123" {
+		t.Errorf("Expected a freshly generated request ID, got '%v'", seen)
+	}
+	if got := rec.Header().Get(handler.RequestIDHeader); got != seen {
+		t.Errorf("Expected response header '%v', got '%v'", seen, got)
+	}
+}
@@ -0,0 +1,78 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics returns the current metrics output.
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleMetrics))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+	return string(body)
+}
+
+// metricValue finds the value of the series in body, 0 when it is not there yet.
+func metricValue(t *testing.T, body, series string) float64 {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestMetricsHandler(t *testing.T) {
+	// Metrics are process-wide, so the test looks at how much they change.
+	const (
+		requests = `dashboard_http_requests_total{route="teapot",method="GET",status="418"}`
+		duration = `dashboard_http_request_duration_seconds_count{route="teapot",method="GET",status="418"}`
+		escaped  = `dashboard_http_requests_total{route="tea \"pot\"\\",method="GET",status="418"}`
+		other    = `dashboard_http_requests_total{route="teapot",method="OTHER",status="418"}`
+	)
+	before := scrapeMetrics(t)
+
+	// Send requests through instrumented handlers so they show up in the metrics.
+	teapot := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }
+	handler.Instrument("teapot", teapot)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/teapot", nil))
+	handler.Instrument(`tea "pot"\`, teapot)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/teapot", nil))
+	// Made-up methods share one series.
+	handler.Instrument("teapot", teapot)(httptest.NewRecorder(), httptest.NewRequest("BREW", "/teapot", nil))
+
+	after := scrapeMetrics(t)
+	for _, series := range []string{requests, duration, escaped, other} {
+		if got := metricValue(t, after, series) - metricValue(t, before, series); got != 1 {
+			t.Errorf("Expected %s to grow by 1, got %v\nBody: %s", series, got, after)
+		}
+	}
+	if strings.Contains(after, `method="BREW"`) {
+		t.Errorf("Expected no series for a made-up method\nBody: %s", after)
+	}
+	for _, line := range []string{"# TYPE dashboard_registrations gauge", "# TYPE dashboard_webhooks gauge"} {
+		if !strings.Contains(after, line) {
+			t.Errorf("Expected metrics output to contain %q\nBody: %s", line, after)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// resetRateHistory forgets the exchange rates earlier tests recorded, by loading a cache file
+// without any.
+func resetRateHistory(t *testing.T) {
+	t.Helper()
+	writeCacheFile(t, `{"rateHistory":null}`)
+	if err := handler.LoadCache(); err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+}
+
+func TestRateHistory(t *testing.T) {
+	resetRateHistory(t)
+	useTransport(t, routeTransport{{"/currency/EUR", `{"rates":{"EUR":1,"NOK":11.7,"USD":1.08}}`}})
+	key := createKey(t, "rates", "viewer")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(handler.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.RequireAPIKey(handler.HandleRates)(rec, req)
+		return rec
+	}
+	type timeSeries struct {
+		Base   string `json:"base"`
+		Target string `json:"target"`
+		Series []struct {
+			Date string  `json:"date"`
+			Rate float64 `json:"rate"`
+		} `json:"series"`
+		Change struct {
+			Day  *float64 `json:"day"`
+			Week *float64 `json:"week"`
+		} `json:"change"`
+	}
+
+	if rec := get("/dashboard/v1/rates/EURO/NOK"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a four-letter code, got %d", rec.Code)
+	}
+	if rec := get("/dashboard/v1/rates/E1R/NOK"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a code that is not all letters, got %d", rec.Code)
+	}
+	if rec := get("/dashboard/v1/rates/EUR/NOK?days=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for zero days, got %d", rec.Code)
+	}
+	if rec := get("/dashboard/v1/rates/XXX/YYY"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a pair without history, got %d", rec.Code)
+	}
+
+	rec := get("/dashboard/v1/rates/eur/nok")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var series timeSeries
+	if err := json.NewDecoder(rec.Body).Decode(&series); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if series.Base != "EUR" || series.Target != "NOK" || len(series.Series) != 1 || series.Series[0].Rate != 11.7 {
+		t.Errorf("Expected today's EUR/NOK rate of 11.7, got %+v", series)
+	}
+	if series.Change.Day != nil || series.Change.Week != nil {
+		t.Errorf("Expected no change without earlier observations, got %+v", series.Change)
+	}
+
+	// Only EUR rates were observed, so NOK/EUR is their inverse.
+	rec = get("/dashboard/v1/rates/NOK/EUR")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&series); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(series.Series) != 1 || series.Series[0].Rate != 1/11.7 {
+		t.Errorf("Expected the inverse rate %v, got %+v", 1/11.7, series.Series)
+	}
+}
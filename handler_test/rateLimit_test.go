@@ -0,0 +1,70 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT_LIMITED", "2")
+	h := handler.RateLimit("limited", func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.RemoteAddr = "198.51.100.7:4321"
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := do(); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to pass, got %d", i+1, rec.Code)
+		}
+	}
+	rec := do()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header")
+	}
+	if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Errorf("Expected RateLimit-Limit 2, got '%v'", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0, got '%v'", got)
+	}
+
+	// Another client has its own bucket.
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.RemoteAddr = "198.51.100.8:4321"
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected other client to pass, got %d", rec.Code)
+	}
+}
+
+// quotaRuns gives every run of TestDailyQuota a client of its own, as quotas last all day.
+var quotaRuns int
+
+func TestDailyQuota(t *testing.T) {
+	t.Setenv("DAILY_QUOTA", "1")
+	h := handler.RateLimit("quota_test", func(w http.ResponseWriter, r *http.Request) {})
+	quotaRuns++
+	client := fmt.Sprintf("203.0.113.%d:1111", quotaRuns)
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/quota_test", nil)
+		req.RemoteAddr = client
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != want {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, want, rec.Code)
+		}
+	}
+}
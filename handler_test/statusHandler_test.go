@@ -11,12 +11,14 @@ import (
 
 func TestStatusHandler(t *testing.T) {
 	// Test serverHandler
-	ts := httptest.NewServer(http.HandlerFunc(handler.HandleStatus))
+	ts := httptest.NewServer(handler.RequireAPIKey(handler.HandleStatus))
 	defer ts.Close()
 
 	t.Log("Server URL: ", ts.URL)
 
-	resp, err := http.Get(ts.URL)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set(handler.APIKeyHeader, createKey(t, "status", "editor"))
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("Failed to make GET request: %v", err)
 	}
@@ -0,0 +1,60 @@
+package handler_test
+
+import (
+	"assignment_02/handler"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// traceExporter records the spans of every test. The handler's tracer only ever delegates to the
+// first global provider, so the provider is installed once and the exporter reset between runs.
+var (
+	traceExporter   = tracetest.NewInMemoryExporter()
+	installProvider sync.Once
+)
+
+func TestTracingSpans(t *testing.T) {
+	installProvider.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(traceExporter)))
+	})
+	exporter := traceExporter
+	exporter.Reset()
+
+	useTransport(t, stubTransport(`[{"name":{"common":"Norway"},"cca2":"NO","currencies":{"NOK":{}}}]`))
+
+	h := handler.Instrument("registrations", handler.RequireAPIKey(handler.RegistrationHandler))
+	req := httptest.NewRequest(http.MethodPost, "/dashboard/v1/registrations/", strings.NewReader(`{"isoCode":"no"}`))
+	req.Header.Set(handler.APIKeyHeader, createKey(t, "tracing", "editor"))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	server, ok := byName["POST registrations"]
+	if !ok {
+		t.Fatalf("Expected a server span, got %d spans", len(spans))
+	}
+	for _, name := range []string{"GET countries", "cache.save"} {
+		span, ok := byName[name]
+		if !ok {
+			t.Errorf("Expected span %q", name)
+			continue
+		}
+		if span.Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("Expected span %q to be a child of the server span", name)
+		}
+	}
+}
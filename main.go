@@ -2,27 +2,58 @@ package main
 
 import (
 	"assignment_02/handler"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"os"
 )
 
 func main() {
 
 	port := "8080"
 
-	log.Println("Firestore client initialized successfully.")
+	handler.SetupLogging()
+	slog.Info("Firestore client initialized successfully.")
 
-	http.HandleFunc("/dashboard/v1/registrations/", handler.RegistrationHandler)
-	http.HandleFunc("/dashboard/v1/dashboards/", handler.HandleDashboard)
-	http.HandleFunc("/dashboard/v1/notifications/", handler.NotificationHandler)
-	http.HandleFunc("/dashboard/v1/notifications/{id}", handler.NotificationHandler)
-	http.HandleFunc("/dashboard/v1/status/", handler.HandleStatus)
+	shutdownTracing, err := handler.SetupTracing(context.Background())
+	if err != nil {
+		slog.Error("error setting up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	if err := handler.LoadCache(); err != nil {
+		slog.Error("error loading cache", "error", err)
+	}
+
+	// Every API route is instrumented, rate limited and (apart from the admin routes) requires an API key.
+	api := func(name string, h http.HandlerFunc) http.HandlerFunc {
+		return handler.Instrument(name, handler.RateLimit(name, handler.RequireAPIKey(h)))
+	}
+	notifications := api("notifications", handler.NotificationHandler)
+
+	http.HandleFunc("/dashboard/v1/registrations/", api("registrations", handler.RegistrationHandler))
+	http.HandleFunc("/dashboard/v1/dashboards/", api("dashboards", handler.HandleDashboard))
+	http.HandleFunc("/dashboard/v1/dashboards/batch", api("dashboards_batch", handler.HandleDashboardBatch))
+	http.HandleFunc("/dashboard/v1/comparisons/", api("comparisons", handler.ComparisonHandler))
+	http.HandleFunc("/dashboard/v1/rates/", api("rates", handler.HandleRates))
+	http.HandleFunc("/dashboard/v1/convert", api("convert", handler.HandleConvert))
+	http.HandleFunc("/dashboard/v1/countries", api("countries", handler.HandleCountrySearch))
+	http.HandleFunc("/dashboard/v1/notifications/", notifications)
+	http.HandleFunc("/dashboard/v1/notifications/{id}", notifications)
+	http.HandleFunc("/dashboard/v1/status/", api("status", handler.HandleStatus))
+	http.HandleFunc("/dashboard/v1/quota/", api("quota", handler.HandleQuota))
+	http.HandleFunc("/dashboard/v1/admin/keys/", handler.Instrument("admin_keys", handler.RateLimit("admin_keys", handler.KeysHandler)))
+	http.HandleFunc("/healthz", handler.HandleHealthz)
+	http.HandleFunc("/readyz", handler.HandleReadyz)
+	http.HandleFunc("/metrics", handler.HandleMetrics)
 
 	fs := http.FileServer(http.Dir("./handler"))
 	http.Handle("/", fs)
 
-	log.Println("Server starting on port " + port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+	slog.Info("server starting", "port", port)
+	if err := http.ListenAndServe(":"+port, handler.WithRequestLogging(http.DefaultServeMux)); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 }